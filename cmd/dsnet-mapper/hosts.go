@@ -30,6 +30,7 @@ var hostsLastChanged = promauto.NewGaugeVec(prometheus.GaugeOpts{
 type Hosts struct {
 	source     string
 	remembered map[string]time.Time
+	labels     map[string]map[string]string
 }
 
 func (h *Hosts) Remember(host ...string) {
@@ -52,12 +53,23 @@ func (h *Hosts) Remember(host ...string) {
 	}
 }
 
+// Label replaces the labels of the hosts in labels
+func (h *Hosts) Label(labels map[string]map[string]string) {
+	if h.labels == nil {
+		h.labels = make(map[string]map[string]string)
+	}
+	for host, hostLabels := range labels {
+		h.labels[host] = hostLabels
+	}
+}
+
 func (h *Hosts) ForgetHostsOlderThan(d time.Duration) {
 	now := time.Now()
 	changed := false
 	for host, lastSeen := range h.remembered {
 		if now.Sub(lastSeen) > d {
 			delete(h.remembered, host)
+			delete(h.labels, host)
 			hostsForgotten.WithLabelValues(h.source).Inc()
 			changed = true
 		}
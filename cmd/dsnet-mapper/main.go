@@ -42,6 +42,7 @@ func main() {
 
 	r.Get("/metrics", promhttp.Handler().ServeHTTP)
 	r.Get("/proxy", server.Proxy)
+	r.Get("/snmp", server.SNMP)
 	r.Get("/api/v1/refresh", server.Refresh)
 	r.Get("/api/v1/report", server.Report)
 	r.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +23,8 @@ type Config struct {
 	MemoryDuration string             `yaml:"memory_duration"`
 	Sources        []framework.Config `yaml:"sources"`
 	Targets        []*TargetConfig    `yaml:"targets"`
+	Traps          *TrapConfig        `yaml:"traps"`
+	SNMP           *SNMPConfig        `yaml:"snmp"`
 }
 
 type Manager struct {
@@ -31,6 +33,9 @@ type Manager struct {
 	lock    sync.RWMutex
 	content map[string]string
 	hosts   map[string]*Hosts
+	snmp    *snmpExporter
+
+	traps *trapListener
 }
 
 func NewManager() *Manager {
@@ -183,7 +188,26 @@ func (m *Manager) ReloadConfig(ctx context.Context, configPath string) error {
 		return err
 	}
 
+	//the exporter and the trap receiver share one set of MIBs
+	db, err := loadMibs(ctx, config.SNMP, config.Traps)
+	if err != nil {
+		return err
+	}
+
+	exporter, err := newSNMPExporter(config.SNMP, db)
+	if err != nil {
+		return err
+	}
+
+	err = m.startTraps(ctx, config.Traps, db)
+	if err != nil {
+		return err
+	}
+
 	m.memoryDuration = memoryDuration
+	m.lock.Lock()
+	m.snmp = exporter
+	m.lock.Unlock()
 
 	go m.backgroundLoop(ctx, scanFrequency, plannedNodes)
 
@@ -222,7 +246,7 @@ func (m *Manager) backgroundLoop(ctx context.Context, scanFrequency time.Duratio
 	}
 }
 
-func (m *Manager) updateHostsFromSource(sourceName string, hosts source.HostList) {
+func (m *Manager) updateHostsFromSource(sourceName string, hosts source.HostList, labels source.HostLabels) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	hostList, ok := m.hosts[sourceName]
@@ -233,6 +257,7 @@ func (m *Manager) updateHostsFromSource(sourceName string, hosts source.HostList
 		m.hosts[sourceName] = hostList
 	}
 	hostList.Remember(hosts...)
+	hostList.Label(labels)
 }
 
 func (m *Manager) getHostsFromSource(sourceName string) source.HostList {
@@ -249,6 +274,30 @@ func (m *Manager) getHostsFromSource(sourceName string) source.HostList {
 	return hosts
 }
 
+// mergeLabelsFromSource adds the labels of the hosts the source remembers to labels
+func (m *Manager) mergeLabelsFromSource(sourceName string, labels source.HostLabels) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	hostCache, ok := m.hosts[sourceName]
+	if !ok {
+		return
+	}
+	for host, hostLabels := range hostCache.labels {
+		labels[host] = mergeLabels(labels[host], hostLabels)
+	}
+}
+
+// mergeLabels combines sets of labels, later sets win
+func mergeLabels(sets ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, set := range sets {
+		for name, value := range set {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
 func (m *Manager) backgroundStep(ctx context.Context, nodeWithPrecursors *job.NodeWithPrecursors) (err error) {
 	log.Default().Printf("Starting %s\n", nodeWithPrecursors.ID())
 	defer func() {
@@ -266,30 +315,48 @@ func (m *Manager) backgroundStep(ctx context.Context, nodeWithPrecursors *job.No
 			if err != nil {
 				return err
 			}
-			m.updateHostsFromSource(node.ID(), hosts)
+			m.updateHostsFromSource(node.ID(), hosts, nil)
 			return nil
 		}
 		filter, ok := node.Impl.(source.Filter)
 		if ok {
 			inputs := make(source.HostList, 0)
+			inputLabels := make(source.HostLabels)
 			for _, precursor := range nodeWithPrecursors.Precursors() {
 				hosts := m.getHostsFromSource(precursor.ID())
 				inputs = append(inputs, hosts...)
+				m.mergeLabelsFromSource(precursor.ID(), inputLabels)
+			}
+			var hosts source.HostList
+			var labels source.HostLabels
+			if labeller, ok := filter.(source.LabellingFilter); ok {
+				hosts, labels, err = labeller.FilterWithLabels(ctx, inputs)
+			} else {
+				hosts, err = filter.Filter(ctx, inputs)
 			}
-			hosts, err := filter.Filter(ctx, inputs)
 			if err != nil {
 				return err
 			}
-			m.updateHostsFromSource(node.ID(), hosts)
+			//hosts keep the labels given by earlier sources
+			outputLabels := make(source.HostLabels)
+			for _, host := range hosts {
+				merged := mergeLabels(inputLabels[host], labels[host])
+				if len(merged) > 0 {
+					outputLabels[host] = merged
+				}
+			}
+			m.updateHostsFromSource(node.ID(), hosts, outputLabels)
 			return nil
 		}
 	case *framework.Plugin[report.Interface]:
 		inputs := make(source.HostList, 0)
+		labels := make(source.HostLabels)
 		for _, precursor := range nodeWithPrecursors.Precursors() {
 			hosts := m.getHostsFromSource(precursor.ID())
 			inputs = append(inputs, hosts...)
+			m.mergeLabelsFromSource(precursor.ID(), labels)
 		}
-		content, err := node.Impl.Generate(ctx, inputs)
+		content, err := node.Impl.Generate(ctx, inputs, labels)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var snmpHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "snmp_duration_seconds",
+	Help: "Duration of SNMP scrapes",
+}, []string{"module", "code"})
+
+type SNMPConfig struct {
+	MibDirectory string                       `yaml:"mib_directory"`
+	MibCache     string                       `yaml:"mib_cache"`
+	Modules      map[string]*SNMPModuleConfig `yaml:"modules"`
+}
+
+// SNMPModuleConfig describes what to walk on a target and how to reach it
+type SNMPModuleConfig struct {
+	Walk           []string `yaml:"walk"`
+	Version        string   `yaml:"version"`
+	Community      string   `yaml:"community"`
+	User           string   `yaml:"user"`
+	AuthProtocol   string   `yaml:"auth_protocol"`
+	AuthPassphrase string   `yaml:"auth_passphrase"`
+	PrivProtocol   string   `yaml:"priv_protocol"`
+	PrivPassphrase string   `yaml:"priv_passphrase"`
+	Timeout        string   `yaml:"timeout"`
+	Retries        *int     `yaml:"retries"`
+	MaxRepetitions int      `yaml:"max_repetitions"`
+	JoinAugments   bool     `yaml:"join_augments"`
+
+	snmp.MetricConfig `yaml:",inline"`
+}
+
+type snmpModule struct {
+	protocol       snmp.Protocol
+	oids           []asn1go.OID
+	maxRepetitions int
+	printerOptions []snmp.MetricPrinterOption
+}
+
+type snmpExporter struct {
+	db      *mibdb.Database
+	modules map[string]*snmpModule
+}
+
+// loadMibs reads the MIBs once for both the exporter and the trap receiver,
+// from the directories either names. It returns nil if neither is configured.
+func loadMibs(ctx context.Context, snmpConfig *SNMPConfig, trapConfig *TrapConfig) (*mibdb.Database, error) {
+	var directories []string
+	cacheFile := ""
+	add := func(directory, cache string) error {
+		if directory != "" && !slices.Contains(directories, directory) {
+			directories = append(directories, directory)
+		}
+		if cache != "" && cacheFile != "" && cache != cacheFile {
+			return fmt.Errorf("snmp and traps have different mib caches %s and %s", cacheFile, cache)
+		}
+		if cache != "" {
+			cacheFile = cache
+		}
+		return nil
+	}
+	if snmpConfig == nil && trapConfig == nil {
+		return nil, nil
+	}
+	if snmpConfig != nil {
+		err := add(snmpConfig.MibDirectory, snmpConfig.MibCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if trapConfig != nil {
+		err := add(trapConfig.MibDirectory, trapConfig.MibCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := mibdb.New(slog.Default())
+	if cacheFile != "" {
+		db.SetCacheFile(cacheFile)
+	}
+	err := db.AddEmbeddedStandard()
+	if err != nil {
+		return nil, err
+	}
+	for _, directory := range directories {
+		err = db.AddDirectory(directory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = db.CreateIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not load mibs from %s: %s", strings.Join(directories, ", "), err)
+	}
+	return db, nil
+}
+
+func newSNMPExporter(config *SNMPConfig, db *mibdb.Database) (*snmpExporter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	e := &snmpExporter{
+		db:      db,
+		modules: make(map[string]*snmpModule),
+	}
+	for name, moduleConfig := range config.Modules {
+		module, err := e.newModule(moduleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("snmp module %s: %s", name, err)
+		}
+		e.modules[name] = module
+	}
+	return e, nil
+}
+
+func (e *snmpExporter) lookupName(name string) (asn1go.OID, error) {
+	object, ok := e.db.LookupName(name).(*mibdb.Object)
+	if !ok {
+		return nil, fmt.Errorf("unknown object %q", name)
+	}
+	return object.OID(), nil
+}
+
+func (e *snmpExporter) newModule(config *SNMPModuleConfig) (*snmpModule, error) {
+	if len(config.Walk) == 0 {
+		return nil, fmt.Errorf("nothing to walk")
+	}
+	module := &snmpModule{maxRepetitions: config.MaxRepetitions}
+	if module.maxRepetitions == 0 {
+		module.maxRepetitions = 25
+	}
+	if config.JoinAugments {
+		module.printerOptions = append(module.printerOptions, snmp.WithAugmentJoin())
+	}
+	err := config.MetricConfig.Check(e.db)
+	if err != nil {
+		return nil, err
+	}
+	module.printerOptions = append(module.printerOptions, snmp.WithMetricConfig(&config.MetricConfig))
+	for _, name := range config.Walk {
+		oid, err := asn1go.ParseOID(name, e.lookupName)
+		if err != nil {
+			return nil, fmt.Errorf("oid %q is invalid: %s", name, err)
+		}
+		module.oids = append(module.oids, oid)
+	}
+
+	if config.Timeout == "" {
+		config.Timeout = "5s"
+	}
+	timeout, err := time.ParseDuration(config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse timeout: %s", err)
+	}
+	options := []snmp.ProtocolOption{snmp.WithReceiveTimeout(timeout)}
+	if config.Retries != nil {
+		options = append(options, snmp.WithRetries(*config.Retries))
+	}
+
+	if config.Version == "" {
+		config.Version = "v2c"
+	}
+	if config.Version != "v3" && config.Community == "" {
+		config.Community = "public"
+	}
+	switch config.Version {
+	case "v1":
+		options = append(options, snmp.WithV1(config.Community))
+	case "v2c":
+		options = append(options, snmp.WithV2(config.Community))
+	case "v3":
+		if config.AuthProtocol == "" {
+			config.AuthProtocol = "none"
+		}
+		if config.PrivProtocol == "" {
+			config.PrivProtocol = "none"
+		}
+		user := snmp.USMUser{
+			Name:           config.User,
+			AuthPassphrase: config.AuthPassphrase,
+			PrivPassphrase: config.PrivPassphrase,
+		}
+		user.AuthProtocol, err = snmp.ParseAuthProtocol(config.AuthProtocol)
+		if err != nil {
+			return nil, err
+		}
+		user.PrivProtocol, err = snmp.ParsePrivProtocol(config.PrivProtocol)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, snmp.WithV3(user))
+	default:
+		return nil, fmt.Errorf("invalid version %s ( need to be one of v1,v2c,v3)", config.Version)
+	}
+	module.protocol, err = snmp.NewProtocol(options...)
+	if err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// scrape walks every subtree of module on target and returns the exposition,
+// in OpenMetrics format if asked for
+func (e *snmpExporter) scrape(ctx context.Context, module *snmpModule, target string, openMetrics bool) ([]byte, error) {
+	conn, err := module.protocol.Dial(target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buffer := &bytes.Buffer{}
+	var sink snmp.MetricSink = snmp.NewPrometheusSink(buffer)
+	if openMetrics {
+		sink = snmp.NewOpenMetricsSink(buffer)
+	}
+	printer := snmp.NewMetricSinkPrinter(sink, e.db, module.printerOptions...)
+	for _, oid := range module.oids {
+		err = snmp.Walk(ctx, conn, oid, printer, snmp.WithMaxRepetitions(module.maxRepetitions))
+		if err != nil {
+			return nil, fmt.Errorf("error walking %s: %w", oid, err)
+		}
+	}
+	err = printer.Flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (m *Manager) snmpExporter() *snmpExporter {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.snmp
+}
+
+// scrapeContext honours the timeout prometheus sends, leaving a little time
+// to write the response
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 1 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), time.Duration((seconds-0.5)*float64(time.Second)))
+}
+
+func (s *Server) SNMP(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	target := r.URL.Query().Get("target")
+	moduleName := r.URL.Query().Get("module")
+
+	code := http.StatusOK
+	defer func() {
+		snmpHistogram.WithLabelValues(moduleName, strconv.Itoa(code)).Observe(time.Since(started).Seconds())
+	}()
+
+	exporter := s.targetManager.snmpExporter()
+	if exporter == nil {
+		code = http.StatusNotFound
+		http.Error(w, "snmp is not configured", code)
+		return
+	}
+	module, ok := exporter.modules[moduleName]
+	if !ok {
+		code = http.StatusBadRequest
+		names := make([]string, 0, len(exporter.modules))
+		for name := range exporter.modules {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		http.Error(w, fmt.Sprintf("unknown module %q, expected one of %v", moduleName, names), code)
+		return
+	}
+	if target == "" {
+		code = http.StatusBadRequest
+		http.Error(w, "target is required", code)
+		return
+	}
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	body, err := exporter.scrape(ctx, module, target, openMetrics)
+	if err != nil {
+		code = http.StatusInternalServerError
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	w.Write(body)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/snmp"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var trapsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "snmp_traps_received",
+	Help: "Number of SNMP traps and informs received",
+}, []string{"source", "trap"})
+
+type TrapConfig struct {
+	Listen       string   `yaml:"listen"`
+	Communities  []string `yaml:"communities"`
+	MibDirectory string   `yaml:"mib_directory"`
+	MibCache     string   `yaml:"mib_cache"`
+
+	Forward *snmp.TrapForwardConfig `yaml:"forward"`
+}
+
+// trapListener is the running trap receiver and the socket it reads
+type trapListener struct {
+	listen string
+	socket net.PacketConn
+	stop   func()
+}
+
+// trapConn lets a reload hand the socket from one receiver to the next, as
+// Serve closes the connection it is given when it stops
+type trapConn struct {
+	net.PacketConn
+	closed atomic.Bool
+}
+
+func (c *trapConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	if c.closed.Load() {
+		return 0, nil, net.ErrClosed
+	}
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err != nil && c.closed.Load() {
+		return n, addr, net.ErrClosed
+	}
+	return n, addr, err
+}
+
+// Close wakes the reader without closing the socket
+func (c *trapConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	return c.PacketConn.SetReadDeadline(time.Now())
+}
+
+// startTraps replaces any running trap receiver with one for config. The
+// running receiver is only stopped once the new one is ready, so a reload
+// that fails leaves it in place.
+func (m *Manager) startTraps(ctx context.Context, config *TrapConfig, db *mibdb.Database) error {
+	if config == nil {
+		m.stopTraps()
+		return nil
+	}
+	if config.Listen == "" {
+		config.Listen = ":162"
+	}
+
+	counter := snmp.NotificationHandlerFunc(func(ctx context.Context, n *snmp.Notification) error {
+		host, _, err := net.SplitHostPort(n.Source.String())
+		if err != nil {
+			host = n.Source.String()
+		}
+		trapsReceived.WithLabelValues(host, snmp.OIDName(db, n.TrapOID)).Inc()
+		return nil
+	})
+	handlers := []snmp.NotificationHandler{snmp.NewLogHandler(slog.Default(), db), counter}
+	var forwarder *snmp.TrapForwarder
+	var err error
+	if config.Forward != nil {
+		forwarder, err = snmp.NewTrapForwarder(config.Forward, db)
+		if err != nil {
+			return fmt.Errorf("invalid trap forwarding: %s", err)
+		}
+		handlers = append(handlers, forwarder)
+	}
+	closeForwarder := func() {
+		if forwarder != nil {
+			forwarder.Close()
+		}
+	}
+	receiver, err := snmp.NewTrapReceiver(
+		snmp.WithTrapCommunities(config.Communities...),
+		snmp.WithNotificationHandler(handlers...),
+	)
+	if err != nil {
+		closeForwarder()
+		return err
+	}
+
+	//the running receiver keeps its socket if the address is unchanged,
+	//otherwise bind now so a bad address is reported with the rest of the config
+	var socket net.PacketConn
+	if m.traps != nil && m.traps.listen == config.Listen {
+		socket = m.traps.socket
+	} else {
+		socket, err = net.ListenPacket("udp", config.Listen)
+		if err != nil {
+			closeForwarder()
+			return fmt.Errorf("could not listen for traps: %s", err)
+		}
+	}
+	if m.traps != nil {
+		m.traps.stop()
+		if m.traps.socket != socket {
+			m.traps.socket.Close()
+		}
+		m.traps = nil
+	}
+	err = socket.SetReadDeadline(time.Time{})
+	if err != nil {
+		socket.Close()
+		closeForwarder()
+		return fmt.Errorf("could not listen for traps: %s", err)
+	}
+
+	conn := &trapConn{PacketConn: socket}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := receiver.Serve(ctx, conn)
+		if err != nil {
+			log.Printf("Trap receiver stopped: %s\n", err)
+		}
+	}()
+	m.traps = &trapListener{
+		listen: config.Listen,
+		socket: socket,
+		stop: func() {
+			cancel()
+			conn.Close()
+			<-done
+			closeForwarder()
+		},
+	}
+	log.Printf("Listening for traps on %s\n", config.Listen)
+	return nil
+}
+
+// stopTraps stops the running trap receiver, if any, and releases its socket
+func (m *Manager) stopTraps() {
+	if m.traps == nil {
+		return
+	}
+	m.traps.stop()
+	m.traps.socket.Close()
+	m.traps = nil
+}
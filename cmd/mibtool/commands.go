@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+	"golang.org/x/exp/maps"
+)
+
+// resolve accepts a numeric OID, with or without a leading dot, or a name
+// optionally qualified by its module as in IF-MIB::ifIndex.1
+func resolve(db *mibdb.Database, s string) (asn1go.OID, error) {
+	moduleName, name, qualified := strings.Cut(s, "::")
+	if !qualified {
+		moduleName, name = "", s
+	}
+	return asn1go.ParseOID(strings.TrimPrefix(name, "."), func(part string) (asn1go.OID, error) {
+		object, ok := db.LookupName(part).(*mibdb.Object)
+		if !ok {
+			return nil, fmt.Errorf("unknown object %q", part)
+		}
+		if moduleName != "" && object.ModuleName() != moduleName {
+			return nil, fmt.Errorf("%s is defined in %s, not %s", part, object.ModuleName(), moduleName)
+		}
+		return object.OID(), nil
+	})
+}
+
+// qualifiedName returns MODULE::name for object
+func qualifiedName(object *mibdb.Object) string {
+	if module := object.ModuleName(); module != "" && !strings.HasPrefix(module, "<") {
+		return module + "::" + object.Name()
+	}
+	return object.Name()
+}
+
+// lookupObject returns the object at or above oid and the sub-identifiers
+// below it
+func lookupObject(db *mibdb.Database, oid asn1go.OID) (*mibdb.Object, asn1go.OID) {
+	branch, tail := db.FindOID(oid)
+	if branch == nil || branch.Object() == nil || branch.Object().Name() == "" {
+		return nil, oid
+	}
+	return branch.Object(), tail
+}
+
+// translate prints numeric OIDs for names and names for numeric OIDs
+func translate(w io.Writer, db *mibdb.Database, args []string) error {
+	var errs []error
+	for _, arg := range args {
+		oid, err := resolve(db, arg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if isNumeric(arg) {
+			fmt.Fprintln(w, oidName(db, oid))
+		} else {
+			fmt.Fprintln(w, oid)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isNumeric(s string) bool {
+	s = strings.TrimPrefix(s, ".")
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// oidName returns MODULE::name.index for oid, or the numeric form if no
+// object covers it
+func oidName(db *mibdb.Database, oid asn1go.OID) string {
+	object, tail := lookupObject(db, oid)
+	if object == nil {
+		return oid.String()
+	}
+	name := qualifiedName(object)
+	if len(tail) > 0 {
+		name += "." + tail.String()
+	}
+	return name
+}
+
+// describe prints what the MIBs say about each object
+func describe(w io.Writer, db *mibdb.Database, args []string) error {
+	var errs []error
+	for i, arg := range args {
+		oid, err := resolve(db, arg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		object, tail := lookupObject(db, oid)
+		if object == nil {
+			errs = append(errs, fmt.Errorf("no object for %s", oid))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		describeObject(w, db, object, tail)
+	}
+	return errors.Join(errs...)
+}
+
+func describeObject(w io.Writer, db *mibdb.Database, object *mibdb.Object, tail asn1go.OID) {
+	field := func(name string, value any) {
+		if s := fmt.Sprint(value); s != "" {
+			fmt.Fprintf(w, "  %-13s %s\n", name+":", s)
+		}
+	}
+	fmt.Fprintln(w, qualifiedName(object))
+	field("OID", object.OID())
+	if len(tail) > 0 {
+		field("INSTANCE", tail)
+	}
+	syntax, _ := object.Get("SYNTAX").(*mibdb.TypeReference)
+	if syntax != nil {
+		field("SYNTAX", syntaxString(syntax))
+	}
+	field("UNITS", stashString(object.Get("UNITS")))
+	field("MAX-ACCESS", stashString(object.Get("MAX-ACCESS")))
+	field("STATUS", stashString(object.Get("STATUS")))
+	field("INDEX", strings.Join(indexNames(object), ", "))
+	if augments, ok := object.Get("AUGMENTS").([]string); ok {
+		field("AUGMENTS", strings.Join(augments, ", "))
+	}
+	if objects, ok := object.Get("OBJECTS").(*mibdb.ValueList); ok {
+		field("OBJECTS", strings.Join(objects.Names(), ", "))
+	}
+	tc := db.TextualConvention(object)
+	if tc != nil {
+		field("DISPLAY-HINT", stashString(tc.Get("DISPLAY-HINT")))
+	}
+	if enums := enumerations(syntax, tc); len(enums) > 0 {
+		keys := maps.Keys(enums)
+		slices.Sort(keys)
+		var values []string
+		for _, key := range keys {
+			values = append(values, fmt.Sprintf("%s(%d)", enums[key], key))
+		}
+		field("VALUES", strings.Join(values, ", "))
+	}
+	field("DESCRIPTION", stashString(object.Get("DESCRIPTION")))
+}
+
+func stashString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	}
+	return ""
+}
+
+// syntaxString formats a SYNTAX as it would be written in a MIB
+func syntaxString(syntax *mibdb.TypeReference) string {
+	s := syntax.Name()
+	if syntax.SequenceOf() {
+		s = "SEQUENCE OF " + s
+	}
+	ranges, size := syntax.CompileRanges()
+	if len(ranges) > 0 {
+		var bounds []string
+		for _, r := range ranges {
+			if r.Min == r.Max {
+				bounds = append(bounds, fmt.Sprint(r.Min))
+			} else {
+				bounds = append(bounds, fmt.Sprintf("%d..%d", r.Min, r.Max))
+			}
+		}
+		constraint := strings.Join(bounds, " | ")
+		if size {
+			constraint = "SIZE (" + constraint + ")"
+		}
+		s += " (" + constraint + ")"
+	}
+	return s
+}
+
+// indexNames returns the INDEX of a table entry, marking an IMPLIED one
+func indexNames(object *mibdb.Object) []string {
+	list, ok := object.Get("INDEX").(*mibdb.ValueList)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, value := range *list {
+		composite, ok := value.(*mibdb.CompositeValue)
+		if !ok {
+			continue
+		}
+		if s, ok := composite.Get("0").(string); ok {
+			names = append(names, s)
+		} else if s, ok := composite.Get("IMPLIED").(string); ok {
+			names = append(names, "IMPLIED "+s)
+		}
+	}
+	return names
+}
+
+// enumerations returns the named numbers of an object's SYNTAX, or of the
+// textual convention it is derived from
+func enumerations(syntax *mibdb.TypeReference, tc *mibdb.CompositeValue) map[int]string {
+	if syntax != nil {
+		if enums := syntax.CompileEnums(); len(enums) > 0 {
+			return enums
+		}
+	}
+	if tc != nil {
+		if syntax, ok := tc.Get("SYNTAX").(*mibdb.TypeReference); ok {
+			return syntax.CompileEnums()
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every named object below branch, depth first in OID
+// order. Branches without a name, such as the one above zeroDotZero, are
+// walked through without adding to the depth.
+func walk(branch *mibdb.OidBranch, depth int, fn func(object *mibdb.Object, depth int)) {
+	for _, child := range branch.Children() {
+		childDepth := depth
+		if object := child.Object(); object != nil && object.Name() != "" {
+			fn(object, depth)
+			childDepth++
+		}
+		walk(child, childDepth, fn)
+	}
+}
+
+// tree prints the objects below an OID, or all of them, indented by depth
+func tree(w io.Writer, db *mibdb.Database, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("tree takes at most one OID")
+	}
+	branch, _ := db.FindOID(nil)
+	depth := 0
+	if len(args) == 1 {
+		oid, err := resolve(db, args[0])
+		if err != nil {
+			return err
+		}
+		var tail asn1go.OID
+		branch, tail = db.FindOID(oid)
+		if branch == nil || branch.Object() == nil || len(tail) > 0 {
+			return fmt.Errorf("no object for %s", oid)
+		}
+		printTreeLine(w, branch.Object(), 0)
+		depth = 1
+	}
+	walk(branch, depth, func(object *mibdb.Object, depth int) {
+		printTreeLine(w, object, depth)
+	})
+	return nil
+}
+
+func printTreeLine(w io.Writer, object *mibdb.Object, depth int) {
+	oid := object.OID()
+	line := fmt.Sprintf("%s%s(%d)", strings.Repeat("  ", depth), object.Name(), oid[len(oid)-1])
+	if syntax, ok := object.Get("SYNTAX").(*mibdb.TypeReference); ok && !syntax.SequenceOf() {
+		if access := stashString(object.Get("MAX-ACCESS")); access != "not-accessible" {
+			line += " " + syntax.Name() + " " + access
+		}
+	}
+	fmt.Fprintln(w, strings.TrimRight(line, " "))
+}
+
+// search lists the objects whose name or DESCRIPTION matches a regular
+// expression
+func search(w io.Writer, db *mibdb.Database, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("search takes one regular expression")
+	}
+	re, err := regexp.Compile(args[0])
+	if err != nil {
+		return err
+	}
+	root, _ := db.FindOID(nil)
+	found := false
+	walk(root, 0, func(object *mibdb.Object, _ int) {
+		if re.MatchString(object.Name()) || re.MatchString(stashString(object.Get("DESCRIPTION"))) {
+			fmt.Fprintf(w, "%-40s %s\n", qualifiedName(object), object.OID())
+			found = true
+		}
+	})
+	if !found {
+		return fmt.Errorf("nothing matches %q", args[0])
+	}
+	return nil
+}
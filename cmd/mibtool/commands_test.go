@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTreeAndSearch(t *testing.T) {
+	db, err := loadMibs(context.Background(), slog.Default(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = tree(&out, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if lines[0] != "zeroDotZero(0)" {
+		t.Errorf("tree starts with %q", lines[0])
+	}
+	printed := make(map[string]bool)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "(") {
+			t.Errorf("tree printed an unnamed node %q", line)
+		}
+		printed[line] = true
+	}
+	for _, want := range []string{"lldpMIB(2)", "org(3)", "lldpRemSysName(9) SnmpAdminString read-only"} {
+		if !printed[want] {
+			t.Errorf("tree is missing %q", want)
+		}
+	}
+
+	out.Reset()
+	err = search(&out, db, []string{"lldpRemSys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "LLDP-MIB::lldpRemSysName") {
+		t.Errorf("search found %q", out.String())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// command runs a subcommand against the loaded MIBs, writing to w and
+// returning an error if any of its arguments could not be handled
+type command func(w io.Writer, db *mibdb.Database, args []string) error
+
+var commands = map[string]command{
+	"translate": translate,
+	"describe":  describe,
+	"tree":      tree,
+	"search":    search,
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] command args...\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  translate oid...   convert between names such as IF-MIB::ifIndex.1 and numeric OIDs")
+	fmt.Fprintln(out, "  describe oid...    show the SYNTAX, MAX-ACCESS, STATUS, INDEX and DESCRIPTION of objects")
+	fmt.Fprintln(out, "  tree [oid]         print the objects below oid, or every object")
+	fmt.Fprintln(out, "  search regexp      list the objects whose name or DESCRIPTION matches")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func defaultCacheFile() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "mibtool-mibs.cache")
+}
+
+func loadMibs(ctx context.Context, logger *slog.Logger, directories, searchPath, cacheFile string) (*mibdb.Database, error) {
+	db := mibdb.New(logger)
+	err := db.AddEmbeddedStandard()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range filepath.SplitList(directories) {
+		err = db.AddDirectory(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db.AddSearchPath(filepath.SplitList(searchPath)...)
+	if cacheFile != "" {
+		db.SetCacheFile(cacheFile)
+	}
+	err = db.CreateIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func main() {
+	directories := flag.String("mibs", "", "directories of MIBs to load as well as the standard ones, separated like PATH")
+	searchPath := flag.String("path", os.Getenv("MIBDIRS"), "directories to find imported modules in, like net-snmp's MIBDIRS")
+	cacheFile := flag.String("cache", defaultCacheFile(), "file to cache compiled MIBs in, empty to disable")
+	debug := flag.Bool("debug", false, "log while loading MIBs")
+	flag.Usage = usage
+	flag.Parse()
+
+	run, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	level := slog.LevelWarn
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	db, err := loadMibs(context.Background(), logger, *directories, *searchPath, *cacheFile)
+	if err != nil {
+		if list, ok := err.(asn1error.List); ok {
+			for _, e := range list {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	err = run(os.Stdout, db, flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
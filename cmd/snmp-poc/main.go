@@ -6,21 +6,38 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 
 	"github.com/davidjspooner/dshttp/pkg/logevent"
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
 	"github.com/davidjspooner/net-mapper/pkg/snmp"
 	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
 )
 
+// vendorMibDirectory holds MIBs beyond the embedded standard ones, if present
+const vendorMibDirectory = "/mnt/homelab-atom/static/mib/"
+
 func ReadAllMibs(ctx context.Context, dirname string, logger *slog.Logger) (*mibdb.Database, error) {
 
 	db := mibdb.New(logger)
 
-	err := db.AddDirectory(dirname)
+	err := db.AddEmbeddedStandard()
 	if err != nil {
 		return nil, err
 	}
+	//like net-snmp, MIBDIRS names directories to find imported modules in
+	db.AddSearchPath(filepath.SplitList(os.Getenv("MIBDIRS"))...)
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		db.SetCacheFile(filepath.Join(cacheDir, "snmp-poc-mibs.cache"))
+	}
+	if _, err := os.Stat(dirname); err == nil {
+		err = db.AddDirectory(dirname)
+		if err != nil {
+			return nil, err
+		}
+	}
 	err = db.CreateIndex(ctx)
 	if err != nil {
 		return nil, err
@@ -100,6 +117,26 @@ func DecodeDump(ctx context.Context, filename string, db *mibdb.Database) error
 	return err
 }
 
+func WalkTarget(ctx context.Context, target string, db *mibdb.Database) error {
+	protocol, err := snmp.NewProtocol(snmp.WithV2("public"))
+	if err != nil {
+		return err
+	}
+	conn, err := protocol.Dial(target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	metricDecoder := snmp.NewMetricPrinter(os.Stdout, db)
+	mib2 := asn1go.OID{1, 3, 6, 1, 2, 1}
+	err = snmp.Walk(ctx, conn, mib2, metricDecoder)
+	if err != nil {
+		return err
+	}
+	return metricDecoder.Flush(ctx)
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -110,7 +147,21 @@ func main() {
 	logger := slog.New(handler)
 	ctx = logevent.WithLogger(ctx, logger)
 
-	db, err := ReadAllMibs(ctx, "/mnt/homelab-atom/static/mib/", logger)
+	if len(os.Args) > 2 && os.Args[1] == "serve" {
+		address := "127.0.0.1:1161"
+		if len(os.Args) > 3 {
+			address = os.Args[3]
+		}
+		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+		defer cancel()
+		err := ServeDump(ctx, os.Args[2], address)
+		if err != nil {
+			fmt.Printf("Error serving %s: %v\n", os.Args[2], err)
+		}
+		return
+	}
+
+	db, err := ReadAllMibs(ctx, vendorMibDirectory, logger)
 
 	if err != nil {
 		list, multiError := err.(asn1error.List)
@@ -128,6 +179,14 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 {
+		err = WalkTarget(ctx, os.Args[1], db)
+		if err != nil {
+			fmt.Printf("Error walking %s: %v\n", os.Args[1], err)
+		}
+		return
+	}
+
 	err = DecodeDump(ctx, "/home/david/current/20240805_homelab/go/tool/dsnet-mapper/dumps/walk-20240914.pcap", db)
 	if err != nil {
 		fmt.Printf("Error decoding dump: %v\n", err)
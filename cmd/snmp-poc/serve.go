@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/davidjspooner/net-mapper/pkg/snmp"
+)
+
+// SnapshotFromDump collects the responses in a pcap into a snapshot
+func SnapshotFromDump(filename string) (*snmp.Snapshot, error) {
+	protocol, err := snmp.NewProtocol(snmp.WithV2("public"))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := snmp.NewSnapshot()
+	err = PlaybackIpFramesFromFile(filename, IPFrameHandleFunc(func(frame *IPFrame) error {
+		if frame.IsFragment {
+			return ErrReassemblyNeeded
+		}
+		if frame.IPProtocol != 17 { //udp
+			return nil
+		}
+		message, err := protocol.DecodeFrame(frame.Data)
+		if err != nil {
+			return fmt.Errorf("unmarshaling SNMP response: %w", err)
+		}
+		snapshot.AddResponse(&message.PDU)
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ServeDump answers requests on address from the responses captured in a pcap
+func ServeDump(ctx context.Context, filename, address string) error {
+	snapshot, err := SnapshotFromDump(filename)
+	if err != nil {
+		return err
+	}
+	agent, err := snmp.NewAgent(snapshot, snmp.WithAgentAddress(address))
+	if err != nil {
+		return err
+	}
+	defer agent.Close()
+	log.Printf("Serving %d varbinds from %s on %s\n", snapshot.Len(), filename, agent.Addr())
+	<-ctx.Done()
+	return nil
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type Interface interface {
-	Generate(ctx context.Context, hosts source.HostList) (string, error)
+	Generate(ctx context.Context, hosts source.HostList, labels source.HostLabels) (string, error)
 }
 
 type FactoryFunc func(args framework.Config) (Interface, error)
@@ -62,13 +62,14 @@ func newTemplatedReport(args framework.Config) (Interface, error) {
 	return r, nil
 }
 
-func (r *templatedReport) Generate(ctx context.Context, hosts source.HostList) (string, error) {
+func (r *templatedReport) Generate(ctx context.Context, hosts source.HostList, labels source.HostLabels) (string, error) {
 	var err error
 	buffer := bytes.Buffer{}
 
 	data := framework.Config{
-		"hosts": hosts,
-		"extra": r.extra,
+		"hosts":  hosts,
+		"labels": labels,
+		"extra":  r.extra,
 	}
 
 	err = r.textTemplate.Execute(&buffer, &data)
@@ -10,6 +10,9 @@ import (
 
 type HostList []string
 
+// HostLabels are what a source learnt about each host, e.g. its vendor
+type HostLabels map[string]map[string]string
+
 type Source interface {
 	Kind() string
 }
@@ -22,6 +25,12 @@ type Filter interface {
 	Filter(ctx context.Context, input HostList) (HostList, error)
 }
 
+// LabellingFilter is a Filter that also labels the hosts it lets through
+type LabellingFilter interface {
+	Filter
+	FilterWithLabels(ctx context.Context, input HostList) (HostList, HostLabels, error)
+}
+
 type FactoryFunc func(criteria framework.Config) (Source, error)
 
 var factories map[string]FactoryFunc
@@ -3,18 +3,51 @@ package source
 import (
 	"context"
 	"fmt"
+	"log"
+	"log/slog"
+	"regexp"
 	"slices"
+	"sync"
+	"time"
 
+	"github.com/davidjspooner/dsflow/pkg/job"
 	"github.com/davidjspooner/net-mapper/internal/framework"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
 )
 
 type snmpFilter struct {
 	community string
 	version   string
+	user      snmp.USMUser
 	oid       []string
+	oids      []asn1go.OID
+	match     *regexp.Regexp
+	timeout   time.Duration
+	db        *mibdb.Database
+
+	fingerprinter *snmp.Fingerprinter
 }
 
-var _ Filter = (*snmpFilter)(nil)
+var _ LabellingFilter = (*snmpFilter)(nil)
+
+// well known names so the default query works without any MIBs loaded
+var systemOIDs = map[string]asn1go.OID{
+	"sysDescr":    {1, 3, 6, 1, 2, 1, 1, 1},
+	"sysObjectID": {1, 3, 6, 1, 2, 1, 1, 2},
+	"sysUpTime":   {1, 3, 6, 1, 2, 1, 1, 3},
+	"sysContact":  {1, 3, 6, 1, 2, 1, 1, 4},
+	"sysName":     {1, 3, 6, 1, 2, 1, 1, 5},
+	"sysLocation": {1, 3, 6, 1, 2, 1, 1, 6},
+}
+
+// the instances fingerprinting looks for in the replies
+var (
+	sysDescrInstance    = asn1go.OID{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	sysObjectIDInstance = asn1go.OID{1, 3, 6, 1, 2, 1, 1, 2, 0}
+)
 
 func ValidateOID(s string) error {
 	if len(s) == 0 {
@@ -24,8 +57,8 @@ func ValidateOID(s string) error {
 		return fmt.Errorf("string too long")
 	}
 	for i, c := range s {
-		if i == 0 && !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
-			return fmt.Errorf("first character must be a letter")
+		if i == 0 && !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return fmt.Errorf("first character must be a letter or digit")
 		}
 		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.') {
 			return fmt.Errorf("invalid character %c", c)
@@ -41,43 +74,287 @@ func init() {
 func newSnmpFilter(args framework.Config) (Source, error) {
 	s := &snmpFilter{}
 
-	err := framework.CheckFields(args, "community", "version", "oid")
+	err := framework.CheckFields(args, "community", "version", "oid", "match", "timeout", "mib_directory",
+		"user", "auth_protocol", "auth_passphrase", "priv_protocol", "priv_passphrase", "fingerprints")
 	if err != nil {
 		return nil, err
 	}
 
+	s.version, err = framework.ConsumeOptionalArg(args, "version", "v2c")
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains([]string{"v1", "v2c", "v3"}, s.version) {
+		return nil, fmt.Errorf("invalid version %s ( need to be one of v1,v2c,v3)", s.version)
+	}
 	s.community, err = framework.ConsumeOptionalArg(args, "community", "")
 	if err != nil {
 		return nil, err
 	}
-	if s.community == "" {
+	if s.version == "v3" {
+		err = s.consumeUser(args)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.community == "" {
 		return nil, fmt.Errorf("community is empty")
 	}
-	s.version, err = framework.ConsumeOptionalArg(args, "version", "v2c")
+
+	s.oid, err = framework.ConsumeOptionalArg(args, "oid", []string{"sysObjectID.0", "sysDescr.0"})
 	if err != nil {
 		return nil, err
 	}
-	if !slices.Contains([]string{"v1", "v2c", "v3"}, s.version) {
-		return nil, fmt.Errorf("invalid version %s ( need to be one of v1,v2c,v3)", s.version)
+	for _, o := range s.oid {
+		err = ValidateOID(o)
+		if err != nil {
+			return nil, fmt.Errorf("oid %q is invalid: %s", o, err)
+		}
 	}
-	s.oid, err = framework.ConsumeOptionalArg(args, "oid", []string{})
+
+	match, err := framework.ConsumeOptionalArg(args, "match", "")
 	if err != nil {
 		return nil, err
 	}
+	if match != "" {
+		s.match, err = regexp.Compile(match)
+		if err != nil {
+			return nil, fmt.Errorf("match %q is invalid: %s", match, err)
+		}
+	}
+
+	timeout, err := framework.ConsumeOptionalArg(args, "timeout", "2s")
+	if err != nil {
+		return nil, err
+	}
+	s.timeout, err = time.ParseDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("timeout %q is invalid: %s", timeout, err)
+	}
+
+	mibDirectory, err := framework.ConsumeOptionalArg(args, "mib_directory", "")
+	if err != nil {
+		return nil, err
+	}
+	if mibDirectory != "" {
+		s.db = mibdb.New(slog.Default())
+		err = s.db.AddEmbeddedStandard()
+		if err != nil {
+			return nil, err
+		}
+		err = s.db.AddDirectory(mibDirectory)
+		if err != nil {
+			return nil, err
+		}
+		err = s.db.CreateIndex(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error loading mibs from %s: %s", mibDirectory, err)
+		}
+	}
+
 	for _, o := range s.oid {
-		err = ValidateOID(o)
+		oid, err := asn1go.ParseOID(o, s.lookupName)
 		if err != nil {
 			return nil, fmt.Errorf("oid %q is invalid: %s", o, err)
 		}
+		s.oids = append(s.oids, oid)
+	}
+
+	err = s.consumeFingerprints(args)
+	if err != nil {
+		return nil, err
 	}
 
 	return s, nil
 }
 
-func (h *snmpFilter) Filter(ctx context.Context, input HostList) (HostList, error) {
-	return nil, fmt.Errorf("snmp condition not implemented")
+// consumeFingerprints reads the rules used ahead of the built-in ones to
+// label hosts with their vendor, model and os
+func (s *snmpFilter) consumeFingerprints(args framework.Config) error {
+	configs, err := framework.ConsumeOptionalArg(args, "fingerprints", []framework.Config{})
+	if err != nil {
+		return err
+	}
+	var rules []snmp.FingerprintRule
+	for i, config := range configs {
+		err = framework.CheckFields(config, "sys_object_id", "sys_descr", "vendor", "model", "os")
+		if err != nil {
+			return fmt.Errorf("fingerprint %d: %s", i+1, err)
+		}
+		var rule snmp.FingerprintRule
+		for field, value := range map[string]*string{
+			"sys_object_id": &rule.SysObjectID,
+			"sys_descr":     &rule.SysDescr,
+			"vendor":        &rule.Vendor,
+			"model":         &rule.Model,
+			"os":            &rule.OS,
+		} {
+			*value, err = framework.ConsumeOptionalArg(config, field, "")
+			if err != nil {
+				return fmt.Errorf("fingerprint %d: %s", i+1, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	s.fingerprinter, err = snmp.NewFingerprinter(s.db, rules...)
+	return err
+}
+
+func (s *snmpFilter) consumeUser(args framework.Config) error {
+	var err error
+	s.user.Name, err = framework.ConsumeArg[string](args, "user")
+	if err != nil {
+		return err
+	}
+	authProtocol, err := framework.ConsumeOptionalArg(args, "auth_protocol", "none")
+	if err != nil {
+		return err
+	}
+	s.user.AuthProtocol, err = snmp.ParseAuthProtocol(authProtocol)
+	if err != nil {
+		return err
+	}
+	s.user.AuthPassphrase, err = framework.ConsumeOptionalArg(args, "auth_passphrase", "")
+	if err != nil {
+		return err
+	}
+	privProtocol, err := framework.ConsumeOptionalArg(args, "priv_protocol", "none")
+	if err != nil {
+		return err
+	}
+	s.user.PrivProtocol, err = snmp.ParsePrivProtocol(privProtocol)
+	if err != nil {
+		return err
+	}
+	s.user.PrivPassphrase, err = framework.ConsumeOptionalArg(args, "priv_passphrase", "")
+	if err != nil {
+		return err
+	}
+	//let the protocol validate the combination now rather than on first use
+	_, err = s.protocol()
+	return err
+}
+
+// lookupName resolves a symbolic OID element using the mibs if loaded
+func (s *snmpFilter) lookupName(name string) (asn1go.OID, error) {
+	if s.db != nil {
+		object, ok := s.db.LookupName(name).(*mibdb.Object)
+		if ok {
+			return object.OID(), nil
+		}
+	}
+	oid, ok := systemOIDs[name]
+	if ok {
+		return oid, nil
+	}
+	return nil, fmt.Errorf("unknown object %q", name)
+}
+
+func (s *snmpFilter) protocol() (snmp.Protocol, error) {
+	options := []snmp.ProtocolOption{snmp.WithReceiveTimeout(s.timeout)}
+	switch s.version {
+	case "v1":
+		options = append(options, snmp.WithV1(s.community))
+	case "v2c":
+		options = append(options, snmp.WithV2(s.community))
+	case "v3":
+		options = append(options, snmp.WithV3(s.user))
+	}
+	return snmp.NewProtocol(options...)
+}
+
+// query returns true if the host answered and, when a match is configured,
+// one of the returned values matched it. Any response counts as an answer,
+// even one with an error status or only exceptions. The labels describe the
+// device when sysObjectID.0 or sysDescr.0 were among the values.
+func (s *snmpFilter) query(ctx context.Context, client *snmp.Client, host string) (bool, map[string]string, error) {
+	conn, err := client.Target(host)
+	if err != nil {
+		return false, nil, err
+	}
+	defer conn.Close()
+
+	pdu := &snmp.PDU{}
+	for _, oid := range s.oids {
+		pdu.VarBinds = append(pdu.VarBinds, snmp.VarBind{OID: oid, Value: asn1binary.Value{Envelope: asn1binary.Envelope{Tag: asn1binary.TagNull}}})
+	}
+	response, err := conn.Request(ctx, snmp.GET, pdu)
+	if err != nil {
+		return false, nil, err
+	}
+	if response.ErrorStatus != int(snmp.NoError) {
+		//e.g. noSuchName from a v1 agent, the values are just the request's
+		return s.match == nil, nil, nil
+	}
+	matched := s.match == nil
+	var sysObjectID asn1go.OID
+	var sysDescr string
+	for i := range response.VarBinds {
+		vb := &response.VarBinds[i]
+		if vb.IsException() {
+			continue
+		}
+		value, _, err := snmp.DecodeValue(s.db, &vb.Value)
+		switch {
+		case vb.OID.Equal(sysObjectIDInstance):
+			vb.Value.UnpackIntoGo(&sysObjectID)
+		case vb.OID.Equal(sysDescrInstance) && err == nil:
+			sysDescr = value
+		}
+		if s.match != nil && err == nil && s.match.MatchString(value) {
+			matched = true
+		}
+	}
+	if !matched {
+		return false, nil, nil
+	}
+	if sysObjectID == nil && sysDescr == "" {
+		return true, nil, nil
+	}
+	return true, s.fingerprinter.Identify(sysObjectID, sysDescr).Labels(), nil
+}
+
+func (s *snmpFilter) Filter(ctx context.Context, input HostList) (HostList, error) {
+	output, _, err := s.FilterWithLabels(ctx, input)
+	return output, err
+}
+
+func (s *snmpFilter) FilterWithLabels(ctx context.Context, input HostList) (HostList, HostLabels, error) {
+	protocol, err := s.protocol()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := snmp.NewClient(protocol, snmp.WithMaxInFlight(64))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	output := make(HostList, 0, len(input))
+	labels := make(HostLabels)
+	lock := sync.Mutex{}
+	executer := job.NewExecuter[string](log.Default())
+	executer.Start(ctx, 64, func(ctx context.Context, host string) error {
+		ok, hostLabels, err := s.query(ctx, client, host)
+		if err != nil || !ok {
+			return nil
+		}
+		log.Printf("SNMP reply from %s \n", host)
+		lock.Lock()
+		defer lock.Unlock()
+		output = append(output, host)
+		if len(hostLabels) > 0 {
+			labels[host] = hostLabels
+		}
+		return nil
+	}, input)
+	err = executer.WaitForCompletion()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, labels, nil
 }
 
-func (h *snmpFilter) Kind() string {
+func (s *snmpFilter) Kind() string {
 	return "snmp_filter"
 }
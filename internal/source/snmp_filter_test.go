@@ -0,0 +1,76 @@
+package source
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/internal/framework"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp"
+)
+
+func testAgent(t *testing.T) *snmp.Agent {
+	sysObjectID, err := snmp.NewOID(asn1go.OID{1, 3, 6, 1, 4, 1, 8072, 3, 2, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := snmp.NewSnapshot(
+		snmp.VarBind{OID: sysDescrInstance, Value: snmp.NewOctetString([]byte("Linux router 6.1.0"))},
+		snmp.VarBind{OID: sysObjectIDInstance, Value: sysObjectID},
+	)
+	agent, err := snmp.NewAgent(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { agent.Close() })
+	return agent
+}
+
+func TestSnmpFilterQuery(t *testing.T) {
+	agent := testAgent(t)
+	tests := []struct {
+		name     string
+		config   framework.Config
+		answered bool
+		labelled bool
+	}{
+		{"v1", framework.Config{"version": "v1"}, true, true},
+		{"v2c", framework.Config{"version": "v2c"}, true, true},
+		{"v1 error status", framework.Config{"version": "v1", "oid": []any{"sysDescr.0", "sysLocation.0"}}, true, false},
+		{"v1 error status with match", framework.Config{"version": "v1", "oid": []any{"sysDescr.0", "sysLocation.0"}, "match": "router"}, false, false},
+		{"v2c exceptions", framework.Config{"version": "v2c", "oid": []any{"sysLocation.0"}}, true, false},
+		{"v2c exceptions with match", framework.Config{"version": "v2c", "oid": []any{"sysLocation.0"}, "match": "router"}, false, false},
+		{"match", framework.Config{"version": "v2c", "match": "router"}, true, true},
+		{"no match", framework.Config{"version": "v2c", "match": "switch"}, false, false},
+		{"wrong community", framework.Config{"version": "v2c", "community": "secret", "timeout": "100ms"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.config["community"]; !ok {
+				tt.config["community"] = "public"
+			}
+			source, err := newSnmpFilter(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter := source.(*snmpFilter)
+			protocol, err := filter.protocol()
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := snmp.NewClient(protocol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			answered, labels, _ := filter.query(context.Background(), client, agent.Addr())
+			if answered != tt.answered {
+				t.Errorf("answered is %v, want %v", answered, tt.answered)
+			}
+			if (labels != nil) != tt.labelled {
+				t.Errorf("unexpected labels %v", labels)
+			}
+		})
+	}
+}
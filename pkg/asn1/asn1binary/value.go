@@ -1,6 +1,7 @@
 package asn1binary
 
 import (
+	"bytes"
 	"io"
 
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
@@ -24,13 +25,13 @@ func (v *Value) Marshal() ([]byte, error) {
 		return b, nil
 	}
 	var encodedLength [6]byte
-	byteCount := length >> 8
-	if length&0xFF != 0 {
+	byteCount := 0
+	for n := length; n > 0; n >>= 8 {
 		byteCount++
 	}
 	encodedLength[0] = byte(0x80 | byteCount)
 	for i := 0; i < byteCount; i++ {
-		encodedLength[byteCount-i] = byte(length >> (i * 8)) //this may need to be reversed - untested
+		encodedLength[byteCount-i] = byte(length >> (i * 8))
 	}
 	b := make([]byte, 2+byteCount+length)
 	b[0] = byte(encodedClassAndBytes)
@@ -69,60 +70,51 @@ func (v *Value) Unmarshal(data []byte) ([]byte, error) {
 	return data[2+byteCount+length:], nil
 }
 
+// ReadFrom reads exactly one value from r, which is how values are framed on
+// a stream. io.EOF is returned only if r ends before the first byte.
 func (v *Value) ReadFrom(r io.Reader) (totalRead int64, err error) {
 
 	var envelope [2]byte
 
 	var chunkRead int
-	chunkRead, err = r.Read(envelope[:])
+	chunkRead, err = io.ReadFull(r, envelope[:])
 	totalRead = int64(chunkRead)
+	if err == io.ErrUnexpectedEOF {
+		return totalRead, asn1error.NewUnexpectedError[int](2, chunkRead, "envelope truncated").WithUnits("byte(s)")
+	}
 	if err != nil {
 		return totalRead, err
 	}
-	if chunkRead != 2 {
-		return totalRead, asn1error.NewUnexpectedError[int](2, chunkRead, "envelope truncated").WithUnits("byte(s)")
-	}
 	v.Class = Class(envelope[0] >> 6)
 	v.Tag = Tag(envelope[0] & 0x3F)
-	if envelope[1] < 128 {
-		v.Bytes = make([]byte, envelope[1])
-		chunkRead, err = r.Read(v.Bytes)
+	length := int64(envelope[1])
+	if length >= 128 {
+		byteCount := int(envelope[1] & 0x7F)
+		if byteCount > 6 {
+			return totalRead, asn1error.NewErrorf("invalid length encoding")
+		}
+		var lengthBytes [6]byte
+		chunkRead, err = io.ReadFull(r, lengthBytes[:byteCount])
 		totalRead += int64(chunkRead)
 		if err != nil {
-			return totalRead, err
+			return totalRead, asn1error.NewUnexpectedError[int](byteCount, chunkRead, "envelope(long) truncated").WithUnits("byte(s)")
 		}
-		if chunkRead != int(envelope[1]) {
-			return totalRead, asn1error.NewUnexpectedError[int](int(envelope[1]), int(totalRead), "frame truncated").WithUnits("byte(s)")
+		length = 0
+		for _, b := range lengthBytes[:byteCount] {
+			length = length<<8 | int64(b)
 		}
-		return totalRead, nil
-	}
-	byteCount := envelope[1] & 0x7F
-	if byteCount > 6 {
-		return totalRead, asn1error.NewErrorf("invalid length encoding")
 	}
-	var lengthBytes [6]byte
-	chunkRead, err = r.Read(lengthBytes[:byteCount])
-	totalRead += totalRead
-	if err != nil {
-		return totalRead, err
-	}
-	if chunkRead != int(byteCount) {
-		return totalRead, asn1error.NewUnexpectedError[int](int(byteCount), chunkRead, "envelope(long) truncated").WithUnits("byte(s)")
+	//grow with the data rather than trusting the length up front
+	buffer := bytes.NewBuffer(make([]byte, 0, min(length, 64*1024)))
+	copied, err := io.CopyN(buffer, r, length)
+	totalRead += copied
+	if err == io.EOF {
+		return totalRead, asn1error.NewUnexpectedError[int64](length, copied, "frame truncated").WithUnits("byte(s)")
 	}
-	length := 0
-
-	for i := 0; i < int(byteCount); i++ {
-		length |= int(lengthBytes[int(byteCount)-i]) << (i * 8)
-	}
-	v.Bytes = make([]byte, length)
-	chunkRead, err = r.Read(v.Bytes)
-	totalRead += int64(chunkRead)
 	if err != nil {
 		return totalRead, err
 	}
-	if chunkRead != length {
-		return totalRead, asn1error.NewUnexpectedError[int](length, chunkRead, "frame(long) truncated").WithUnits("byte(s)")
-	}
+	v.Bytes = buffer.Bytes()
 	return totalRead, nil
 }
 
@@ -0,0 +1,56 @@
+package asn1binary
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestValueLength(t *testing.T) {
+	lengthTests := []struct {
+		Length int
+		Header []byte
+	}{
+		{Length: 0, Header: []byte{0x04, 0x00}},
+		{Length: 127, Header: []byte{0x04, 0x7F}},
+		{Length: 128, Header: []byte{0x04, 0x81, 0x80}},
+		{Length: 255, Header: []byte{0x04, 0x81, 0xFF}},
+		{Length: 256, Header: []byte{0x04, 0x82, 0x01, 0x00}},
+		{Length: 65535, Header: []byte{0x04, 0x82, 0xFF, 0xFF}},
+		{Length: 65536, Header: []byte{0x04, 0x83, 0x01, 0x00, 0x00}},
+	}
+	for _, test := range lengthTests {
+		content := bytes.Repeat([]byte{0xA5}, test.Length)
+		t.Run(fmt.Sprintf("marshal %d", test.Length), func(t *testing.T) {
+			v := Value{Envelope: Envelope{Tag: TagOctetString}, Bytes: content}
+			b, err := v.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b[:len(b)-test.Length], test.Header) || !bytes.Equal(b[len(test.Header):], content) {
+				t.Errorf("got header 0x%X, want 0x%X", b[:min(len(b), len(test.Header))], test.Header)
+			}
+		})
+		data := append(append([]byte{}, test.Header...), content...)
+		t.Run(fmt.Sprintf("unmarshal %d", test.Length), func(t *testing.T) {
+			var v Value
+			tail, err := v.Unmarshal(append(data, 0x05, 0x00))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Tag != TagOctetString || len(v.Bytes) != test.Length || !bytes.Equal(tail, []byte{0x05, 0x00}) {
+				t.Errorf("got %s with %d byte(s) and tail 0x%X", v.Envelope.String(), len(v.Bytes), tail)
+			}
+		})
+		t.Run(fmt.Sprintf("read %d", test.Length), func(t *testing.T) {
+			var v Value
+			n, err := v.ReadFrom(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(data)) || len(v.Bytes) != test.Length {
+				t.Errorf("read %d byte(s) with %d of content, want %d and %d", n, len(v.Bytes), len(data), test.Length)
+			}
+		})
+	}
+}
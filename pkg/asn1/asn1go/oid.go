@@ -117,3 +117,15 @@ func (o OID) LessThan(other OID) bool {
 	}
 	return len(o) < len(other)
 }
+
+func (o OID) Equal(other OID) bool {
+	if len(o) != len(other) {
+		return false
+	}
+	for i := range o {
+		if o[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
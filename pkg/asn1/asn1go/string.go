@@ -21,7 +21,7 @@ func (v *String) PackAsn1(params *asn1binary.Parameters) (asn1binary.Envelope, [
 		}
 	}
 	switch e.Tag {
-	case asn1binary.TagUTF8String:
+	case asn1binary.TagUTF8String, asn1binary.TagOctetString:
 		return e, []byte(v.Elem), nil
 	case asn1binary.TagBMPString:
 		b := make([]byte, 0, len(v.Elem)*2)
@@ -24,7 +24,7 @@ func (srh *sliceReflectHandler) PackAsn1(reflectedValue *reflect.Value, params *
 		if err != nil {
 			return asn1binary.Envelope{}, nil, err
 		}
-		asn1Value.Envelope, asn1Value.Bytes, err = packer.PackAsn1(params)
+		asn1Value.Envelope, asn1Value.Bytes, err = packer.PackAsn1(nil)
 		if err != nil {
 			return asn1binary.Envelope{}, nil, err
 		}
@@ -34,7 +34,12 @@ func (srh *sliceReflectHandler) PackAsn1(reflectedValue *reflect.Value, params *
 		}
 		b.Write(elemChunk)
 	}
-	return asn1binary.Envelope{Tag: asn1binary.TagSequence}, b.Bytes(), nil
+	e := asn1binary.Envelope{Tag: asn1binary.TagSequence | asn1binary.Constructed}
+	err := params.Update(&e)
+	if err != nil {
+		return asn1binary.Envelope{}, nil, err
+	}
+	return e, b.Bytes(), nil
 }
 
 const maxint = int(^uint(0) >> 1)
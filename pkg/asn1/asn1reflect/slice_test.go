@@ -0,0 +1,59 @@
+package asn1reflect
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+)
+
+type sequenceOfTest struct {
+	Community string   `asn1:"OctetString"`
+	Tagged    []string `asn1:"Sequence,Constructed"`
+	Untagged  []int
+}
+
+func TestSequenceOfEnvelope(t *testing.T) {
+	value := sequenceOfTest{Community: "public", Tagged: []string{"a", "b"}, Untagged: []int{3}}
+	packer, err := getPackerFor(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v asn1binary.Value
+	v.Envelope, v.Bytes, err = packer.PackAsn1(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Class != asn1binary.ClassUniversal || v.Tag != asn1binary.TagSequence|asn1binary.Constructed {
+		t.Errorf("struct packed as %s", v.Envelope.String())
+	}
+	b, err := v.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the elements keep their own tags, only the SEQUENCE OF takes the field's
+	want := []byte{
+		0x30, 0x15,
+		0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0x30, 0x06, 0x0C, 0x01, 'a', 0x0C, 0x01, 'b',
+		0x30, 0x03, 0x02, 0x01, 0x03,
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got 0x%X, want 0x%X", b, want)
+	}
+
+	var got sequenceOfTest
+	unpacker, err := getUnpackerForReflectedValue(reflect.ValueOf(&got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = unpacker.UnpackAsn1(v.Envelope, v.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Community != value.Community || !slices.Equal(got.Tagged, value.Tagged) || !slices.Equal(got.Untagged, value.Untagged) {
+		t.Errorf("got %v, want %v", got, value)
+	}
+}
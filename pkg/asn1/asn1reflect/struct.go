@@ -65,7 +65,7 @@ func (sfh *structFieldHandler) PackAsn1(reflectedValue *reflect.Value, params *a
 	}
 
 	i := 0
-	e := asn1binary.Envelope{}
+	e := asn1binary.Envelope{Tag: asn1binary.TagSequence | asn1binary.Constructed}
 	if fieldsHelper.hasEnvelope {
 		i++
 		e = reflectedValue.Field(0).Interface().(asn1binary.Envelope)
@@ -89,11 +89,16 @@ func (sfh *structFieldHandler) PackAsn1(reflectedValue *reflect.Value, params *a
 		if err != nil {
 			return asn1binary.Envelope{}, nil, asn1error.NewErrorf("packing field %q", fieldsHelper.fields[i].Name).WithCause(err)
 		}
-		i++
+		//implicit tagging, the field tag wins over whatever the packer chose
+		err = fieldParams.Update(&asn1Value.Envelope)
+		if err != nil {
+			return asn1binary.Envelope{}, nil, asn1error.NewErrorf("tagging field %q", fieldsHelper.fields[i].Name).WithCause(err)
+		}
 		elemChunk, err := asn1Value.Marshal()
 		if err != nil {
 			return asn1binary.Envelope{}, nil, asn1error.NewErrorf("marshalling field %q", fieldsHelper.fields[i].Name).WithCause(err)
 		}
+		i++
 		b.Write(elemChunk)
 	}
 	return e, b.Bytes(), nil
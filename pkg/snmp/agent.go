@@ -0,0 +1,304 @@
+package snmp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+)
+
+// maxBulkVarBinds caps the size of a GET_BULK response
+const maxBulkVarBinds = 512
+
+// Agent is a minimal v1/v2c agent that answers GET, GET_NEXT and GET_BULK
+// from a Snapshot. It is intended for tests, where many can be started on
+// loopback addresses to stand in for a fleet of devices.
+type Agent struct {
+	snapshot    *Snapshot
+	address     string
+	communities []string
+	conn        net.PacketConn
+	listener    net.Listener
+	done        chan struct{}
+
+	lock    sync.Mutex
+	closed  bool
+	streams map[net.Conn]struct{}
+}
+
+type AgentOption func(a *Agent) error
+
+// WithAgentAddress sets the listen address, the default is a random loopback
+// port. A tcp:// prefix serves SNMP over TCP instead of UDP.
+func WithAgentAddress(address string) AgentOption {
+	return func(a *Agent) error {
+		a.address = address
+		return nil
+	}
+}
+
+// WithAgentCommunities sets the accepted communities, the default is "public"
+func WithAgentCommunities(communities ...string) AgentOption {
+	return func(a *Agent) error {
+		a.communities = communities
+		return nil
+	}
+}
+
+// NewAgent binds the agent's address and starts serving in the background
+func NewAgent(snapshot *Snapshot, options ...AgentOption) (*Agent, error) {
+	a := &Agent{
+		snapshot:    snapshot,
+		address:     "127.0.0.1:0",
+		communities: []string{"public"},
+		done:        make(chan struct{}),
+		streams:     make(map[net.Conn]struct{}),
+	}
+	for _, option := range options {
+		err := option(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	network, address := splitScheme(a.address)
+	var err error
+	if network == "tcp" {
+		a.listener, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on %s: %v", a.address, err)
+		}
+		go a.accept()
+		return a, nil
+	}
+	a.conn, err = net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", a.address, err)
+	}
+	go a.serve()
+	return a, nil
+}
+
+// Addr returns the address the agent is listening on, suitable for Dial
+func (a *Agent) Addr() string {
+	if a.listener != nil {
+		return "tcp://" + a.listener.Addr().String()
+	}
+	return a.conn.LocalAddr().String()
+}
+
+func (a *Agent) Close() error {
+	if a.listener == nil {
+		err := a.conn.Close()
+		<-a.done
+		return err
+	}
+	err := a.listener.Close()
+	a.lock.Lock()
+	a.closed = true
+	for conn := range a.streams {
+		conn.Close()
+	}
+	a.lock.Unlock()
+	<-a.done
+	return err
+}
+
+func (a *Agent) serve() {
+	defer close(a.done)
+	buffer := make([]byte, 65535)
+	for {
+		n, from, err := a.conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		frame, err := a.handle(buffer[:n])
+		if err != nil || frame == nil {
+			continue
+		}
+		a.conn.WriteTo(frame, from)
+	}
+}
+
+func (a *Agent) accept() {
+	defer close(a.done)
+	var streams sync.WaitGroup
+	defer streams.Wait()
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		a.lock.Lock()
+		if a.closed {
+			a.lock.Unlock()
+			conn.Close()
+			return
+		}
+		a.streams[conn] = struct{}{}
+		a.lock.Unlock()
+		streams.Add(1)
+		go func() {
+			defer streams.Done()
+			a.serveStream(conn)
+		}()
+	}
+}
+
+// serveStream answers the messages on one TCP connection in order until
+// the client hangs up
+func (a *Agent) serveStream(conn net.Conn) {
+	defer func() {
+		a.lock.Lock()
+		delete(a.streams, conn)
+		a.lock.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		frame, err = a.handle(frame)
+		if err != nil || frame == nil {
+			continue
+		}
+		_, err = conn.Write(frame)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle returns nil for requests that get no answer, such as those with
+// an unknown community
+func (a *Agent) handle(frame []byte) ([]byte, error) {
+	version, err := peekVersion(frame)
+	if err != nil {
+		return nil, err
+	}
+	if version != v1 && version != v2c {
+		return nil, nil
+	}
+	var p protocol
+	request, err := p.DecodeFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(a.communities, request.Community) {
+		return nil, nil
+	}
+
+	pdu := &request.PDU
+	var response *PDU
+	switch pdu.Tag {
+	case GET:
+		response = a.get(version, pdu)
+	case GET_NEXT:
+		response = a.getNext(version, pdu)
+	case GET_BULK:
+		if version == v1 {
+			return nil, nil
+		}
+		response = a.getBulk(pdu)
+	case SET:
+		status := NotWritable
+		if version == v1 {
+			status = NoSuchName
+		}
+		response = errorResponse(pdu, status, 1)
+	default:
+		return nil, nil
+	}
+	response.RequestID = pdu.RequestID
+	response.Envelope = asn1binary.Envelope{Class: asn1binary.ClassContextSpecific, Tag: RESPONSE}
+
+	msg := Message{Version: version, Community: request.Community, PDU: *response}
+	return asn1binary.Marshal(&msg)
+}
+
+func exception(tag asn1binary.Tag) asn1binary.Value {
+	return newValue(asn1binary.ClassContextSpecific, tag, nil)
+}
+
+// errorResponse echoes the request varbinds as RFC 3416 requires for errors
+func errorResponse(pdu *PDU, status ErrorStatus, index int) *PDU {
+	return &PDU{ErrorStatus: int(status), ErrorIndex: index, VarBinds: pdu.VarBinds}
+}
+
+func (a *Agent) get(version int, pdu *PDU) *PDU {
+	response := &PDU{}
+	for i, vb := range pdu.VarBinds {
+		found, ok := a.snapshot.Get(vb.OID)
+		if !ok {
+			if version == v1 {
+				return errorResponse(pdu, NoSuchName, i+1)
+			}
+			found = VarBind{OID: vb.OID, Value: exception(NO_SUCH_OBJECT)}
+		}
+		response.VarBinds = append(response.VarBinds, found)
+	}
+	return response
+}
+
+func (a *Agent) getNext(version int, pdu *PDU) *PDU {
+	response := &PDU{}
+	for i, vb := range pdu.VarBinds {
+		found, ok := a.snapshot.Next(vb.OID)
+		if !ok {
+			if version == v1 {
+				return errorResponse(pdu, NoSuchName, i+1)
+			}
+			found = VarBind{OID: vb.OID, Value: exception(END_OF_MIB_VIEW)}
+		}
+		response.VarBinds = append(response.VarBinds, found)
+	}
+	return response
+}
+
+// getBulk follows RFC 3416 section 4.2.3
+func (a *Agent) getBulk(pdu *PDU) *PDU {
+	nonRepeaters := min(max(pdu.ErrorStatus, 0), len(pdu.VarBinds))
+	maxRepetitions := max(pdu.ErrorIndex, 0)
+
+	next := func(vb VarBind) VarBind {
+		found, ok := a.snapshot.Next(vb.OID)
+		if !ok {
+			return VarBind{OID: vb.OID, Value: exception(END_OF_MIB_VIEW)}
+		}
+		return found
+	}
+
+	response := &PDU{}
+	for _, vb := range pdu.VarBinds[:nonRepeaters] {
+		response.VarBinds = append(response.VarBinds, next(vb))
+	}
+	last := slices.Clone(pdu.VarBinds[nonRepeaters:])
+	for r := 0; r < maxRepetitions && len(last) > 0; r++ {
+		if len(response.VarBinds)+len(last) > maxBulkVarBinds {
+			break
+		}
+		ended := true
+		for i := range last {
+			last[i] = next(last[i])
+			if !last[i].IsException() {
+				ended = false
+			}
+		}
+		response.VarBinds = append(response.VarBinds, last...)
+		if ended {
+			break
+		}
+	}
+	return response
+}
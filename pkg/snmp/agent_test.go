@@ -0,0 +1,177 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const testWalk = `.1.3.6.1.2.1.1.1.0 = STRING: "Linux switch 5.10
+second line"
+.1.3.6.1.2.1.1.2.0 = OID: .1.3.6.1.4.1.8072.3.2.10
+.1.3.6.1.2.1.1.3.0 = Timeticks: (1234567) 3:25:45.67
+.1.3.6.1.2.1.1.5.0 = ""
+.1.3.6.1.2.1.2.1.0 = INTEGER: 2
+.1.3.6.1.2.1.2.2.1.2.1 = STRING: "lo"
+.1.3.6.1.2.1.2.2.1.2.2 = STRING: "eth0"
+.1.3.6.1.2.1.2.2.1.6.2 = Hex-STRING: 00 11 22 33 44 55
+.1.3.6.1.2.1.2.2.1.8.1 = INTEGER: up(1)
+.1.3.6.1.2.1.2.2.1.8.2 = INTEGER: down(2)
+.1.3.6.1.2.1.2.2.1.10.2 = Counter32: 4294967295
+.1.3.6.1.2.1.4.20.1.1.10.0.0.1 = IpAddress: 10.0.0.1
+.1.3.6.1.2.1.31.1.1.1.6.2 = Counter64: 18446744073709551615
+`
+
+type collector struct {
+	lock     sync.Mutex
+	varBinds []VarBind
+}
+
+func (c *collector) Handle(ctx context.Context, vb *VarBind) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.varBinds = append(c.varBinds, *vb)
+	return nil
+}
+
+func (c *collector) Flush(ctx context.Context) error {
+	return nil
+}
+
+func TestReadSnapshotText(t *testing.T) {
+	snapshot, err := ReadSnapshotText(strings.NewReader(testWalk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Len() != 13 {
+		t.Fatalf("got %d varbinds, want 13", snapshot.Len())
+	}
+	vb, ok := snapshot.Get(sysDescr)
+	if !ok || string(vb.Value.Bytes) != "Linux switch 5.10\nsecond line" {
+		t.Errorf("sysDescr is %q", vb.Value.Bytes)
+	}
+	vb, _ = snapshot.Get(asn1go.OID{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 6, 2})
+	if fmt.Sprintf("%x", vb.Value.Bytes) != "00ffffffffffffffff" {
+		t.Errorf("Counter64 encoded as %x", vb.Value.Bytes)
+	}
+	vb, ok = snapshot.Next(asn1go.OID{1, 3, 6, 1, 2, 1, 2, 2})
+	if !ok || !vb.OID.Equal(asn1go.OID{1, 3, 6, 1, 2, 1, 2, 2, 1, 2, 1}) {
+		t.Errorf("next after ifTable is %s", vb.OID)
+	}
+}
+
+func TestReadSnapshotJSON(t *testing.T) {
+	snapshot, err := ReadSnapshotJSON(strings.NewReader(`[
+		{"oid": ".1.3.6.1.2.1.1.1.0", "type": "STRING", "value": "\"router\""},
+		{"oid": "1.3.6.1.2.1.1.3.0", "type": "Timeticks", "value": "(42) 0:00:00.42"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vb, ok := snapshot.Get(sysDescr)
+	if !ok || string(vb.Value.Bytes) != "router" {
+		t.Errorf("sysDescr is %q", vb.Value.Bytes)
+	}
+}
+
+// TestAgentFleet walks many simulated devices at once through a shared client
+func TestAgentFleet(t *testing.T) {
+	snapshot, err := ReadSnapshotText(strings.NewReader(testWalk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []ProtocolOption{WithV1("public"), WithV2("public")} {
+		p, err := NewProtocol(version, WithReceiveTimeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := NewClient(p, WithMaxInFlight(16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 30; i++ {
+			agent, err := NewAgent(snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer agent.Close()
+			conn, err := client.Target(agent.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c := &collector{}
+				err := Walk(context.Background(), conn, asn1go.OID{1, 3, 6, 1}, c, WithMaxRepetitions(4))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(c.varBinds) != snapshot.Len() {
+					t.Errorf("walked %d varbinds, want %d", len(c.varBinds), snapshot.Len())
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestAgentErrors(t *testing.T) {
+	snapshot := NewSnapshot()
+	agent, err := NewAgent(snapshot, WithAgentCommunities("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	request := &PDU{VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}}
+
+	p, _ := NewProtocol(WithV1("secret"))
+	conn, err := p.Dial(agent.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	response, err := conn.Request(context.Background(), GET, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsErrorStatus(CheckPDU(response), NoSuchName) || response.ErrorIndex != 1 {
+		t.Errorf("v1 get of missing object gave status %d index %d", response.ErrorStatus, response.ErrorIndex)
+	}
+
+	p, _ = NewProtocol(WithV2("secret"))
+	conn, err = p.Dial(agent.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	response, err = conn.Request(context.Background(), GET, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.VarBinds[0].Value.Tag != NO_SUCH_OBJECT {
+		t.Errorf("v2c get of missing object gave %v", response.VarBinds[0].Value.Envelope)
+	}
+
+	p, _ = NewProtocol(WithV2("public"), WithReceiveTimeout(100*time.Millisecond), WithRetries(0))
+	conn, err = p.Dial(agent.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Request(context.Background(), GET, request)
+	if err == nil {
+		t.Error("request with the wrong community was answered")
+	}
+}
@@ -0,0 +1,295 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client sends requests to many agents over a small pool of unconnected UDP
+// sockets. Responses are routed back to the waiting request by source
+// address and request id (msgID for v3).
+type Client struct {
+	protocol    *protocol
+	socketCount int
+	maxInFlight int
+	interval    time.Duration
+
+	sockets    []*net.UDPConn
+	nextSocket atomic.Uint32
+	inFlight   chan struct{}
+	readers    sync.WaitGroup
+
+	lock     sync.Mutex
+	closed   bool
+	pending  map[pendingKey]chan []byte
+	limiters map[netip.AddrPort]*limiter
+}
+
+type pendingKey struct {
+	addr netip.AddrPort
+	id   int
+}
+
+type ClientOption func(c *Client) error
+
+// WithSockets sets how many sockets requests are spread over
+func WithSockets(n int) ClientOption {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("at least one socket is required")
+		}
+		c.socketCount = n
+		return nil
+	}
+}
+
+// WithMaxInFlight caps the number of outstanding requests across all targets
+func WithMaxInFlight(n int) ClientOption {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("max in flight must be at least 1")
+		}
+		c.maxInFlight = n
+		return nil
+	}
+}
+
+// WithTargetRate limits how many messages per second are sent to any one
+// target, retries and v3 discovery included
+func WithTargetRate(perSecond float64) ClientOption {
+	return func(c *Client) error {
+		if perSecond <= 0 {
+			return fmt.Errorf("target rate must be positive")
+		}
+		c.interval = time.Duration(float64(time.Second) / perSecond)
+		return nil
+	}
+}
+
+func NewClient(p Protocol, options ...ClientOption) (*Client, error) {
+	proto, ok := p.(*protocol)
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol implementation %T", p)
+	}
+	c := &Client{
+		protocol:    proto,
+		socketCount: 1,
+		maxInFlight: 256,
+		pending:     make(map[pendingKey]chan []byte),
+		limiters:    make(map[netip.AddrPort]*limiter),
+	}
+	for _, option := range options {
+		err := option(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.inFlight = make(chan struct{}, c.maxInFlight)
+	for i := 0; i < c.socketCount; i++ {
+		socket, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("error opening socket: %v", err)
+		}
+		c.sockets = append(c.sockets, socket)
+		c.readers.Add(1)
+		go c.receive(socket)
+	}
+	return c, nil
+}
+
+// Target returns a connection to address that shares the client's sockets.
+// Only Request is supported, Receive has no way to know which response is
+// wanted. Unlike Dial, requests may be issued from several goroutines at
+// once. Closing the connection leaves the sockets open. TCP targets need a
+// connection of their own, use Dial for them.
+func (c *Client) Target(address string) (Connection, error) {
+	network, address := splitScheme(address)
+	if network != "udp" {
+		return nil, fmt.Errorf("client sockets only support udp, dial %s://%s instead", network, address)
+	}
+	udpAddr, err := resolveTarget(address)
+	if err != nil {
+		return nil, err
+	}
+	key := unmapped(udpAddr.AddrPort())
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+	var l *limiter
+	if c.interval > 0 {
+		l = c.limiters[key]
+		if l == nil {
+			l = &limiter{interval: c.interval}
+			c.limiters[key] = l
+		}
+	}
+	socket := c.sockets[int(c.nextSocket.Add(1))%len(c.sockets)]
+	t := &sharedTransport{client: c, socket: socket, addr: udpAddr, key: key, limiter: l}
+	return &connection{protocol: c.protocol, transport: t}, nil
+}
+
+func (c *Client) Close() error {
+	c.lock.Lock()
+	c.closed = true
+	c.lock.Unlock()
+
+	var errs []error
+	for _, socket := range c.sockets {
+		err := socket.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.readers.Wait()
+	return errors.Join(errs...)
+}
+
+func (c *Client) receive(socket *net.UDPConn) {
+	defer c.readers.Done()
+	buffer := make([]byte, c.protocol.bufferSize)
+	for {
+		n, from, err := socket.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		id, err := peekRequestID(buffer[:n])
+		if err != nil {
+			continue
+		}
+		c.lock.Lock()
+		inbox := c.pending[pendingKey{addr: unmapped(from), id: id}]
+		c.lock.Unlock()
+		if inbox == nil {
+			//nobody is waiting, most likely a late reply to a retried request
+			continue
+		}
+		frame := make([]byte, n)
+		copy(frame, buffer[:n])
+		select {
+		case inbox <- frame:
+		default:
+			//the request already has more than enough to look at
+		}
+	}
+}
+
+func unmapped(addr netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+}
+
+// limiter spaces out messages to a single target
+type limiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.lock.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.lock.Unlock()
+
+	if !at.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sharedTransport is the view of a Client socket used by a single target
+type sharedTransport struct {
+	client  *Client
+	socket  *net.UDPConn
+	addr    *net.UDPAddr
+	key     netip.AddrPort
+	limiter *limiter
+}
+
+func (t *sharedTransport) expect(ctx context.Context, id int) error {
+	select {
+	case t.client.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	t.client.lock.Lock()
+	defer t.client.lock.Unlock()
+	if t.client.closed {
+		<-t.client.inFlight
+		return net.ErrClosed
+	}
+	t.client.pending[pendingKey{addr: t.key, id: id}] = make(chan []byte, 4)
+	return nil
+}
+
+func (t *sharedTransport) release(id int) {
+	t.client.lock.Lock()
+	delete(t.client.pending, pendingKey{addr: t.key, id: id})
+	t.client.lock.Unlock()
+	<-t.client.inFlight
+}
+
+func (t *sharedTransport) write(ctx context.Context, frame []byte) error {
+	if t.limiter != nil {
+		err := t.limiter.wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := t.socket.WriteToUDP(frame, t.addr)
+	if err != nil {
+		return fmt.Errorf("error sending SNMP message: %v", err)
+	}
+	return nil
+}
+
+func (t *sharedTransport) read(ctx context.Context, id int, deadline time.Time) ([]byte, error) {
+	if id == anyID {
+		return nil, fmt.Errorf("shared connections only support Request")
+	}
+	t.client.lock.Lock()
+	inbox := t.client.pending[pendingKey{addr: t.key, id: id}]
+	t.client.lock.Unlock()
+	if inbox == nil {
+		return nil, fmt.Errorf("no request outstanding with id %d", id)
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case frame := <-inbox:
+		return frame, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("error reading SNMP message: %w", os.ErrDeadlineExceeded)
+	}
+}
+
+func (t *sharedTransport) close() error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+// echoAgent answers every v2c request with sysDescr set to name
+func echoAgent(t *testing.T, name string) string {
+	p, err := NewProtocol(WithV2("public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			message, err := p.DecodeFrame(buffer[:n])
+			if err != nil {
+				t.Log(err)
+				continue
+			}
+			descr := asn1binary.Value{}
+			descr.PackFromGoWithParameters(&asn1go.String{Elem: name}, &asn1binary.Parameters{Tag: asn1binary.PtrToTag(asn1binary.TagOctetString)})
+			reply := &PDU{RequestID: message.PDU.RequestID, VarBinds: []VarBind{{OID: sysDescr, Value: descr}}}
+			frame, err := p.EncodePDU(RESPONSE, reply)
+			if err != nil {
+				t.Log(err)
+				continue
+			}
+			conn.WriteToUDP(frame, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestClientDemux(t *testing.T) {
+	p, err := NewProtocol(WithV2("public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(p, WithSockets(2), WithMaxInFlight(3), WithTargetRate(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	agents := []string{"alpha", "beta", "gamma"}
+	var wg sync.WaitGroup
+	for _, name := range agents {
+		conn, err := client.Target(echoAgent(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response, err := conn.Request(context.Background(), GET, &PDU{VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := string(response.VarBinds[0].Value.Bytes); got != name {
+					t.Errorf("got response from %s, want %s", got, name)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -1,6 +1,8 @@
 package snmp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -9,43 +11,243 @@ import (
 )
 
 type connection struct {
-	protocol *protocol
-	conn     *net.UDPConn
+	protocol  *protocol
+	transport transport
+	engine    engineState
+}
+
+func (c *connection) Version() int {
+	return c.protocol.version
 }
 
 func (c *connection) Close() error {
-	if c.conn != nil {
-		err := c.conn.Close()
-		c.conn = nil
+	if c.transport != nil {
+		err := c.transport.close()
+		c.transport = nil
 		return err
 	}
 	return fmt.Errorf("connection already closed")
 }
 
 func (c *connection) Send(pType asn1binary.Tag, pdu *PDU) error {
+	return c.send(context.Background(), pType, pdu)
+}
+
+func (c *connection) send(ctx context.Context, pType asn1binary.Tag, pdu *PDU) error {
+	if c.protocol.version == v3 {
+		err := c.synchronise(ctx)
+		if err != nil {
+			return err
+		}
+		return c.sendV3(ctx, pType, pdu, v3Options{
+			engine: &c.engine,
+			msgID:  pdu.RequestID,
+			flags:  reportableFlag(pType),
+		})
+	}
 
 	bytes, err := c.protocol.EncodePDU(pType, pdu)
 	if err != nil {
 		return err
 	}
-	_, err = c.conn.Write(bytes)
+	return c.transport.write(ctx, bytes)
+}
+
+// Receive waits up to the receive timeout for the next message. It does no
+// correlation, most callers want Request instead.
+func (c *connection) Receive() (*PDU, error) {
+	frame, err := c.transport.read(context.Background(), anyID, time.Now().Add(c.protocol.receiveTimeout))
 	if err != nil {
-		return fmt.Errorf("error sending SNMP message: %v", err)
+		return nil, err
 	}
-	return nil
+	_, pdu, err := c.decode(frame)
+	return pdu, err
 }
 
-func (c *connection) Receive() (*PDU, error) {
-	buffer := make([]byte, 4096) //TODO: use a buffer pool
-	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-	n, err := c.conn.Read(buffer)
+// decode returns the id used to correlate the message with a request, the
+// request id for v1/v2c and the msgID for v3
+func (c *connection) decode(frame []byte) (int, *PDU, error) {
+	if c.protocol.version == v3 {
+		return c.receiveV3(frame)
+	}
+	message, err := c.protocol.DecodeFrame(frame)
 	if err != nil {
-		return nil, fmt.Errorf("error reading SNMP message: %v", err)
+		return 0, nil, err
 	}
+	return message.PDU.RequestID, &message.PDU, nil
+}
 
-	message, err := c.protocol.DecodeFrame(buffer[:n])
+// Request allocates a request id, sends the pdu and waits for the matching
+// response. Datagrams that do not match (late answers to earlier requests,
+// duplicates, garbage) are discarded. Unanswered requests are resent up to
+// the configured number of retries, with the timeout growing by the backoff
+// factor each time. A connection should only be used by one goroutine.
+func (c *connection) Request(ctx context.Context, pType asn1binary.Tag, pdu *PDU) (*PDU, error) {
+	pdu.RequestID = c.protocol.nextRequestID()
+	if c.protocol.version == v3 {
+		//discover first so the probes are not nested inside this request
+		err := c.synchronise(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := c.transport.expect(ctx, pdu.RequestID)
 	if err != nil {
 		return nil, err
 	}
-	return &message.PDU, nil
+	defer c.transport.release(pdu.RequestID)
+
+	timeout := c.protocol.receiveTimeout
+	var lastErr error
+	for attempt := 0; attempt <= c.protocol.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err := c.send(ctx, pType, pdu)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		capped := false
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline, capped = d, true
+		}
+		response, err := c.await(ctx, pdu.RequestID, deadline)
+		if err == nil {
+			return response, nil
+		}
+		if capped && isTimeout(err) {
+			//the read deadline can fire a moment before the context notices
+			<-ctx.Done()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var report *ReportError
+		switch {
+		case errors.As(err, &report):
+			if !report.recoverable() {
+				return nil, err
+			}
+			//the engine state has been updated from the report so just resend
+		case !isTimeout(err):
+			return nil, err
+		}
+		lastErr = err
+		timeout = time.Duration(float64(timeout) * c.protocol.backoff)
+	}
+	return nil, fmt.Errorf("no response after %d attempts: %w", c.protocol.retries+1, lastErr)
+}
+
+// await reads until a message with the given id arrives or the deadline passes
+func (c *connection) await(ctx context.Context, id int, deadline time.Time) (*PDU, error) {
+	for {
+		frame, err := c.transport.read(ctx, id, deadline)
+		if err != nil {
+			return nil, err
+		}
+		got, pdu, err := c.decode(frame)
+		if got != id {
+			//stale, duplicate or undecodable, keep waiting
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pdu.Tag != RESPONSE {
+			continue
+		}
+		return pdu, nil
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *connection) sendV3(ctx context.Context, pType asn1binary.Tag, pdu *PDU, options v3Options) error {
+	bytes, err := c.protocol.encodeV3(pType, pdu, options)
+	if err != nil {
+		return err
+	}
+	return c.transport.write(ctx, bytes)
+}
+
+func (c *connection) receiveV3(frame []byte) (int, *PDU, error) {
+	msg, params, pdu, err := c.protocol.decodeV3(frame)
+	if err != nil {
+		return 0, nil, err
+	}
+	level := msg.GlobalData.Flags[0] & (flagAuth | flagPriv)
+	want := c.protocol.usm.user.flags()
+	if pdu.Tag == REPORT {
+		report := reportError(pdu)
+		//reports carry the agent's view of the engine, which is how both
+		//discovery and a lost time window are recovered. An unauthenticated
+		//one could be forged, so it is only trusted while discovering the
+		//engine or when the user has no keys to protect (RFC 3414 section 4)
+		if level&flagAuth != 0 || want&flagAuth == 0 || !c.engine.discovered() {
+			c.engine.update(params)
+			return msg.GlobalData.MsgID, nil, report
+		}
+		if report.recoverable() {
+			//resending would not help as nothing has been learnt, so ignore it
+			return 0, nil, fmt.Errorf("unauthenticated %w", report)
+		}
+		return msg.GlobalData.MsgID, nil, report
+	}
+	if level != want {
+		return 0, nil, fmt.Errorf("response security level %d does not match the user's %d", level, want)
+	}
+	if len(params.EngineID) > 0 && want&flagAuth != 0 {
+		c.engine.update(params)
+	}
+	return msg.GlobalData.MsgID, pdu, nil
+}
+
+// synchronise discovers the agent's engine id, and for authenticated users
+// its boots and time, as described in RFC 3414 section 4
+func (c *connection) synchronise(ctx context.Context) error {
+	if !c.engine.discovered() {
+		err := c.probe(ctx, v3Options{noSecurity: true})
+		if err != nil {
+			return fmt.Errorf("engine discovery: %w", err)
+		}
+		if !c.engine.discovered() {
+			return fmt.Errorf("engine discovery: agent did not report an engine id")
+		}
+	}
+	if c.protocol.usm.user.AuthProtocol != NoAuth && !c.engine.synchronised() {
+		err := c.probe(ctx, v3Options{})
+		if err != nil {
+			return fmt.Errorf("time synchronisation: %w", err)
+		}
+	}
+	return nil
+}
+
+// probe sends an empty GET and expects a Report-PDU back
+func (c *connection) probe(ctx context.Context, options v3Options) error {
+	options.engine = &c.engine
+	options.msgID = c.protocol.nextRequestID()
+	options.flags = flagReportable
+	err := c.transport.expect(ctx, options.msgID)
+	if err != nil {
+		return err
+	}
+	defer c.transport.release(options.msgID)
+	err = c.sendV3(ctx, GET, &PDU{RequestID: options.msgID}, options)
+	if err != nil {
+		return err
+	}
+	_, err = c.await(ctx, options.msgID, time.Now().Add(c.protocol.receiveTimeout))
+	var report *ReportError
+	if errors.As(err, &report) {
+		return nil
+	}
+	return err
 }
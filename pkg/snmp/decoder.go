@@ -9,25 +9,56 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
 	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
 )
 
 type MetricPrinter struct {
-	w               io.Writer
+	sink            MetricSink
 	db              *mibdb.Database
 	lastPrintedMeta *MetricMeta
 
-	metricBlock   MetricBlock
-	headerPrinted bool
+	metricBlock MetricBlock
+
+	join       bool
+	deferred   []*MetricBlock
+	walked     []*MetricBlock // the deferred blocks while they are printed
+	timestamps bool
+	rules      *metricRules
 }
 
 var _ VarBindHandler = &MetricPrinter{}
 
-func NewMetricPrinter(w io.Writer, db *mibdb.Database) *MetricPrinter {
-	mp := &MetricPrinter{w: w, db: db}
+type MetricPrinterOption func(printer *MetricPrinter)
+
+// WithAugmentJoin holds back table rows until Flush so that tables related by
+// AUGMENTS share their labels, e.g. ifName from ifXTable on ifTable counters
+func WithAugmentJoin() MetricPrinterOption {
+	return func(printer *MetricPrinter) {
+		printer.join = true
+	}
+}
+
+// WithTimestamps stamps each sample with the time its block was complete
+func WithTimestamps() MetricPrinterOption {
+	return func(printer *MetricPrinter) {
+		printer.timestamps = true
+	}
+}
+
+// NewMetricPrinter writes metrics to w in the prometheus text format
+func NewMetricPrinter(w io.Writer, db *mibdb.Database, options ...MetricPrinterOption) *MetricPrinter {
+	return NewMetricSinkPrinter(NewPrometheusSink(w), db, options...)
+}
+
+// NewMetricSinkPrinter decodes varbinds into metric families written to sink
+func NewMetricSinkPrinter(sink MetricSink, db *mibdb.Database, options ...MetricPrinterOption) *MetricPrinter {
+	mp := &MetricPrinter{sink: sink, db: db}
+	for _, option := range options {
+		option(mp)
+	}
 	mp.metricBlock.Init(nil)
 	return mp
 }
@@ -58,11 +89,25 @@ func (printer *MetricPrinter) Handle(ctx context.Context, vb *VarBind) error {
 		printer.db.Logger().WarnContext(ctx, "Oid not known", slog.String("OID", oid.String()+".*"))
 		return nil
 	}
-	s, _, err := DecodeValue(printer.db, &vb.Value)
+	s, valueType, err := DecodeValue(printer.db, &vb.Value)
 	if err != nil {
 		printer.db.Logger().WarnContext(ctx, "Error decoding value", slog.String("OID", vb.OID.String()), slog.String("error", err.Error()))
 		return err
 	}
+	if valueType.IsException() {
+		return nil
+	}
+	if meta.snmpType == "Opaque" && valueType != FloatValue && valueType != DoubleValue {
+		//only the floats net-snmp wraps in an Opaque make a sample
+		return nil
+	}
+	switch valueType {
+	case FloatValue, DoubleValue, Counter64Value:
+		return printer.queueLine(ctx, meta, metaParent.table, index, Value{text: s, numeric: true})
+	}
+	if value, ok := printer.applyDisplayHint(meta, valueType, vb.Value.Bytes, s); ok {
+		return printer.queueLine(ctx, meta, metaParent.table, index, value)
+	}
 	if strings.Contains(meta.displayHint, "x:") {
 		sb := strings.Builder{}
 		for i, b := range []byte(s) {
@@ -80,16 +125,48 @@ func (printer *MetricPrinter) Handle(ctx context.Context, vb *VarBind) error {
 			s = fmt.Sprintf("%d", n)
 		}
 	} else if !strings.Contains(meta.displayHint, "a") {
-		err = printer.queueLine(ctx, meta, metaParent.table, index, Value{s, true})
+		err = printer.queueLine(ctx, meta, metaParent.table, index, Value{text: s, numeric: true})
 		return err
 	}
-	err = printer.queueLine(ctx, meta, metaParent.table, index, Value{s, false})
+	err = printer.queueLine(ctx, meta, metaParent.table, index, Value{text: s})
 	return err
 }
 
+// applyDisplayHint formats a value with the DISPLAY-HINT of its textual
+// convention. Integers stay numeric for metrics, scaled by any implied
+// decimal places, unless they are labels.
+func (printer *MetricPrinter) applyDisplayHint(meta *MetricMeta, valueType ValueType, b []byte, s string) (Value, bool) {
+	hint := meta.hint
+	if hint == nil {
+		return Value{}, false
+	}
+	switch valueType {
+	case StringValue, OpaqueValue:
+		if hint.IsInteger() {
+			return Value{}, false
+		}
+		return Value{text: hint.FormatOctets(b)}, true
+	case IntegerValue, GaugeValue, CounterValue, UnsignedValue:
+		if !hint.IsInteger() || meta.enums != nil {
+			return Value{}, false
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return Value{}, false
+		}
+		if hint.IsDecimal() {
+			return Value{text: hint.FormatInteger(n), numeric: true}, true
+		}
+		if meta.IsLabel() {
+			return Value{text: hint.FormatInteger(n)}, true
+		}
+	}
+	return Value{}, false
+}
+
 func (printer *MetricPrinter) queueLine(ctx context.Context, meta *MetricMeta, table *Table, index asn1go.OID, value Value) error {
 	if (printer.lastPrintedMeta != meta) && (printer.metricBlock.table != table || table == nil) {
-		err := printer.Flush(ctx)
+		err := printer.endBlock(ctx)
 		if err != nil {
 			return err
 		}
@@ -103,15 +180,18 @@ func (printer *MetricPrinter) queueLine(ctx context.Context, meta *MetricMeta, t
 		tail := index
 		var err error
 		var value2 Value
-		for _, columnName := range printer.metricBlock.table.index {
+		table := printer.metricBlock.table
+		for i, columnName := range table.index {
 			def := printer.db.LookupName(string(columnName))
 			if def != nil {
 				obj, _ := def.(*mibdb.Object)
 				if obj != nil {
-					value2, tail, err = printer.Unmarshal(obj, tail)
+					implied := table.implied && i == len(table.index)-1
+					value2, tail, err = printer.unmarshal(obj, index, implied)
 					if err != nil {
 						return err
 					}
+					value2.index = slices.Clone(index[:len(index)-len(tail)])
 					index = tail
 					meta2 := printer.MetaDataForObject(obj, nil)
 					err := printer.metricBlock.AddMetric(printer, meta2, row, value2)
@@ -128,70 +208,152 @@ func (printer *MetricPrinter) queueLine(ctx context.Context, meta *MetricMeta, t
 	return err
 }
 
-func (printer *MetricPrinter) printMetricRow(labels string, meta *MetricMeta, value string) error {
-	var err error
-	if !printer.headerPrinted {
-		if meta.help != "" {
-			fmt.Fprintf(printer.w, "# HELP %s %s\n", meta.snakeName, meta.help)
+func (printer *MetricPrinter) Flush(ctx context.Context) error {
+	err := printer.endBlock(ctx)
+	if err != nil {
+		return err
+	}
+	printer.walked = printer.deferred
+	printer.deferred = nil
+	defer func() { printer.walked = nil }()
+	for _, block := range printer.walked {
+		var related []*MetricBlock
+		for _, other := range printer.walked {
+			if printer.join && other.table != block.table && other.table.base() == block.table.base() {
+				related = append(related, other)
+			}
 		}
-		if meta.Type != "" {
-			fmt.Fprintf(printer.w, "# TYPE %s %s\n", meta.snakeName, meta.Type)
+		err = printer.printBlock(ctx, block, related)
+		if err != nil {
+			return err
 		}
-		printer.headerPrinted = true
 	}
-	if len(labels) == 0 {
-		_, err = fmt.Fprintf(printer.w, "%s %s\n", meta.snakeName, value)
+	return printer.sink.Flush(ctx)
+}
+
+// endBlock prints the current block, or holds it back to be joined with
+// related tables or used for lookups, and starts a new one
+func (printer *MetricPrinter) endBlock(ctx context.Context) error {
+	deferTables := printer.join || (printer.rules != nil && len(printer.rules.lookups) > 0)
+	if deferTables && printer.metricBlock.table != nil {
+		block := printer.metricBlock
+		printer.deferred = append(printer.deferred, &block)
+		printer.metricBlock = MetricBlock{}
 	} else {
-		_, err = fmt.Fprintf(printer.w, "%s{%s} %s\n", meta.snakeName, labels, value)
+		err := printer.printBlock(ctx, &printer.metricBlock, nil)
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	printer.metricBlock.Init(nil)
+	printer.lastPrintedMeta = nil
+	return nil
 }
 
-func (printer *MetricPrinter) Flush(ctx context.Context) error {
+func (printer *MetricPrinter) printBlock(ctx context.Context, block *MetricBlock, related []*MetricBlock) error {
 
-	labelMap := printer.metricBlock.LabelMap()
+	rules := printer.rules
+	labels, labelMap := block.labelMap(rules, related)
+	labels = rules.addLookups(block, printer.walked, labels, labelMap)
+	labelNames := labelNames(labels)
+	if rules != nil && len(rules.staticNames) > 0 {
+		labelNames = append(labelNames, rules.staticNames...)
+		if labelMap == nil {
+			labelMap = make(map[RowIndex]map[string]string)
+		}
+		for _, row := range block.rowIndexes {
+			if labelMap[row] == nil {
+				labelMap[row] = make(map[string]string, len(rules.staticNames))
+			}
+			for name, value := range rules.staticLabels {
+				labelMap[row][name] = value
+			}
+		}
+	}
+	var timestamp time.Time
+	if printer.timestamps {
+		timestamp = time.Now()
+	}
 
 	output_count := 0
-	for _, metricName := range printer.metricBlock.metricNames {
-		values := printer.metricBlock.metrics[metricName]
-		if values.Meta.IsLabel() {
-			continue
-		}
-		printer.headerPrinted = false
-		for _, row := range printer.metricBlock.rowIndexes {
-			value, ok := values.Values[row]
-			if ok {
-				if !value.numeric {
+	for _, metricName := range block.metricNames {
+		values := block.metrics[metricName]
+		meta := values.Meta
+		var family *MetricFamily
+		if rules.isInfo(meta) {
+			family = printer.infoFamily(block, meta, labelNames, labelMap, timestamp)
+		} else {
+			if rules.isLabel(meta) || meta.IsLabel() || !rules.exported(meta) {
+				continue
+			}
+			family = meta.family(labelNames)
+			family.Name = rules.metricName(meta)
+			for _, row := range block.rowIndexes {
+				value, ok := values.Values[row]
+				if !ok || !value.numeric {
 					continue
 				}
-				labels := labelMap[row]
-				err := printer.printMetricRow(labels, values.Meta, value.text)
+				f, err := strconv.ParseFloat(value.text, 64)
 				if err != nil {
-					return err
+					printer.db.Logger().WarnContext(ctx, "Value is not a number", slog.String("metric", family.Name), slog.String("value", value.text))
+					continue
 				}
-				output_count++
+				family.Samples = append(family.Samples, Sample{Labels: labelMap[row], Value: f, Timestamp: timestamp})
 			}
 		}
+		if len(family.Samples) == 0 {
+			continue
+		}
+		err := printer.sink.WriteFamily(ctx, family)
+		if err != nil {
+			return err
+		}
+		output_count += len(family.Samples)
 	}
-	if output_count == 0 && printer.metricBlock.table != nil {
-		tableMetricMeta := printer.metricBlock.table.metricMeta
-		printer.headerPrinted = false
-		for _, row := range printer.metricBlock.rowIndexes {
-			labels := labelMap[row]
-			err := printer.printMetricRow(labels, tableMetricMeta, "1")
-			if err != nil {
-				return err
-			}
+	if output_count == 0 && block.table != nil && len(block.rowIndexes) > 0 && rules.exported(block.table.metricMeta) {
+		family := block.table.metricMeta.family(labelNames)
+		family.Name = rules.metricName(block.table.metricMeta)
+		for _, row := range block.rowIndexes {
+			family.Samples = append(family.Samples, Sample{Labels: labelMap[row], Value: 1, Timestamp: timestamp})
 		}
+		return printer.sink.WriteFamily(ctx, family)
 	}
 	return nil
 }
 
+// infoFamily exports a string column as a metric with the value 1 and the
+// string as a label
+func (printer *MetricPrinter) infoFamily(block *MetricBlock, meta *MetricMeta, labelNames []string, labelMap map[RowIndex]map[string]string, timestamp time.Time) *MetricFamily {
+	rules := printer.rules
+	label := meta.snakeName
+	if block.table != nil && slices.Contains(block.table.columns, meta) {
+		label = meta.snakeName[len(block.table.prefix):]
+	}
+	family := meta.family(append(slices.Clone(labelNames), label))
+	family.Name = rules.metricName(meta)
+	if !strings.HasSuffix(family.Name, "_info") {
+		family.Name += "_info"
+	}
+	family.Type = MetricGauge
+	for _, row := range block.rowIndexes {
+		value, ok := block.metrics[meta.name].Values[row]
+		if !ok {
+			continue
+		}
+		labels := make(map[string]string, len(labelMap[row])+1)
+		for name, v := range labelMap[row] {
+			labels[name] = v
+		}
+		labels[label] = value.text
+		family.Samples = append(family.Samples, Sample{Labels: labels, Value: 1, Timestamp: timestamp})
+	}
+	return family
+}
+
 func (printer *MetricPrinter) calculateDisplayHint(object *mibdb.Object, meta *MetricMeta) {
 	if meta.displayHint != "" {
 		return
 	}
-	meta.displayHint, _ = object.Get("DISPLAY-HINT").(string)
 	syntax := object.Get("SYNTAX")
 findDisplayHint:
 	for meta.displayHint == "" && syntax != nil {
@@ -214,9 +376,12 @@ findDisplayHint:
 			case "DisplayString":
 				meta.displayHint = "a"
 				meta.flags |= MetricIsString
-			case "Opaque", "OCTET STRING":
+			case "OCTET STRING":
 				meta.displayHint = "b"
 				meta.flags |= MetricIsString
+			case "Opaque":
+				//may hold a float, anything else is skipped by Handle
+				meta.displayHint = "b"
 			case "TimeTicks":
 				meta.displayHint = "n"
 			case "IpAddress", "NetworkAddress":
@@ -225,11 +390,14 @@ findDisplayHint:
 			case "PhysAddress":
 				meta.displayHint = "x:"
 				meta.flags |= MetricIsString
+				if meta.hint == nil {
+					meta.hint, _ = ParseDisplayHint("1x:")
+				}
 			case "Gauge32":
-				meta.Type = "GAUGE"
+				meta.Type = MetricGauge
 				meta.displayHint = "n"
 			case "Counter", "Counter32", "Counter64":
-				meta.Type = "COUNTER"
+				meta.Type = MetricCounter
 				meta.displayHint = "n"
 				if !strings.HasSuffix(meta.snakeName, "_total") {
 					meta.snakeName += "_total"
@@ -243,6 +411,8 @@ findDisplayHint:
 				syntax = syntax3
 			}
 		case *mibdb.CompositeValue:
+			//textual convention, the nearest DISPLAY-HINT applies
+			printer.compileDisplayHint(object, meta, syntax2)
 			syntax = syntax2.Get("SYNTAX")
 			if syntax == syntax2 {
 				break findDisplayHint
@@ -254,6 +424,19 @@ findDisplayHint:
 	}
 }
 
+func (printer *MetricPrinter) compileDisplayHint(object *mibdb.Object, meta *MetricMeta, tc *mibdb.CompositeValue) {
+	text, _ := tc.Get("DISPLAY-HINT").(string)
+	if meta.hint != nil || text == "" {
+		return
+	}
+	hint, err := ParseDisplayHint(text)
+	if err != nil {
+		printer.db.Logger().Warn("Ignoring DISPLAY-HINT", slog.String("object", object.Name()), slog.String("error", err.Error()))
+		return
+	}
+	meta.hint = hint
+}
+
 func (printer *MetricPrinter) ConvertCamelCaseToSnakeCase(name string) string {
 	sb := strings.Builder{}
 	var prev rune
@@ -280,6 +463,7 @@ func (printer *MetricPrinter) MetaDataForObject(object *mibdb.Object, children [
 	name := object.Name()
 	meta = &MetricMeta{
 		name:      MetricName(name),
+		oid:       object.OID(),
 		snakeName: printer.ConvertCamelCaseToSnakeCase(name),
 	}
 
@@ -304,9 +488,21 @@ func (printer *MetricPrinter) MetaDataForObject(object *mibdb.Object, children [
 
 	printer.calculateDisplayHint(object, meta)
 	index := object.Get("INDEX")
-	if index != nil {
+	augments := printer.augmentedTable(object)
+	if index != nil || augments != nil {
 		meta.table = &Table{
 			metricMeta: meta,
+			augments:   augments,
+		}
+		if augments != nil {
+			//rows are indexed like the base table and labelled by its index columns
+			meta.table.index = augments.index
+			meta.table.implied = augments.implied
+			for _, column := range augments.columns {
+				if column.flags&MetricIsPartOfIndex != 0 {
+					meta.table.columns = append(meta.table.columns, column)
+				}
+			}
 		}
 		valueList, ok := index.(*mibdb.ValueList)
 		if ok {
@@ -317,6 +513,12 @@ func (printer *MetricPrinter) MetaDataForObject(object *mibdb.Object, children [
 					s, ok := v.(string)
 					if ok {
 						meta.table.index = append(meta.table.index, MetricName(s))
+						continue
+					}
+					s, ok = compositeValue.Get("IMPLIED").(string)
+					if ok {
+						meta.table.index = append(meta.table.index, MetricName(s))
+						meta.table.implied = true
 					}
 				}
 			}
@@ -355,6 +557,23 @@ func (printer *MetricPrinter) MetaDataForObject(object *mibdb.Object, children [
 	return meta
 }
 
+// augmentedTable returns the base table of an entry with an AUGMENTS clause
+func (printer *MetricPrinter) augmentedTable(object *mibdb.Object) *Table {
+	names, _ := object.Get("AUGMENTS").([]string)
+	if len(names) != 1 {
+		return nil
+	}
+	base, ok := printer.db.LookupName(names[0]).(*mibdb.Object)
+	if !ok || base == object {
+		return nil
+	}
+	branch, tail := printer.db.FindOID(base.OID())
+	if branch == nil || len(tail) > 0 {
+		return nil
+	}
+	return printer.MetaDataForBranch(branch).table
+}
+
 func (printer *MetricPrinter) MetaDataForBranch(branch *mibdb.OidBranch) *MetricMeta {
 	object := branch.Object()
 	meta, _ := object.Get("metricMeta").(*MetricMeta)
@@ -368,23 +587,21 @@ func (printer *MetricPrinter) MetaDataForBranch(branch *mibdb.OidBranch) *Metric
 
 type unmarshallerFunc func(data asn1go.OID) (Value, asn1go.OID, error)
 
+// Unmarshal decodes the value of the index column oidValue from the start
+// of data, returning the remaining sub-identifiers
 func (printer *MetricPrinter) Unmarshal(oidValue *mibdb.Object, data asn1go.OID) (Value, asn1go.OID, error) {
-	var unmarshaller unmarshallerFunc = nil
-	unmarshaller, _ = oidValue.Get("unmarshaller").(unmarshallerFunc)
-	if unmarshaller == nil {
-		//built it and store it in the oidValue
-		//TODO really build it
-		unmarshaller = func(data asn1go.OID) (Value, asn1go.OID, error) {
-			if len(data) == 0 {
-				return Value{}, data, asn1error.NewErrorf("OID element %d is truncated", 0)
-			}
-			head := data[0]
-			data = data[1:]
-			return Value{strconv.Itoa(head), true}, data, nil
-		}
+	return printer.unmarshal(oidValue, data, false)
+}
+
+func (printer *MetricPrinter) unmarshal(oidValue *mibdb.Object, data asn1go.OID, implied bool) (Value, asn1go.OID, error) {
+	key := "unmarshaller"
+	if implied {
+		key = "impliedUnmarshaller"
 	}
-	if unmarshaller != nil {
-		return unmarshaller(data)
+	unmarshaller, _ := oidValue.Get(key).(unmarshallerFunc)
+	if unmarshaller == nil {
+		unmarshaller = printer.buildUnmarshaller(oidValue, implied)
+		oidValue.Set(key, unmarshaller)
 	}
-	return Value{}, data, asn1error.NewUnimplementedError("MetricPrinter.Unmarshal not implemented")
+	return unmarshaller(data)
 }
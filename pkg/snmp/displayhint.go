@@ -0,0 +1,188 @@
+package snmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// octetFormat is one specification of an OCTET STRING DISPLAY-HINT
+type octetFormat struct {
+	repeat     bool // the first octet is a repeat count
+	length     int
+	format     byte
+	separator  byte
+	terminator byte
+}
+
+// DisplayHint is a DISPLAY-HINT clause of a textual convention as defined in
+// RFC 2579 section 3.1. It describes either an INTEGER or an OCTET STRING.
+type DisplayHint struct {
+	text     string
+	octets   []octetFormat
+	format   byte // of an integer
+	decimals int  // implied decimal places of an integer, as in "d-2"
+}
+
+// ParseDisplayHint compiles hint, e.g. "1x:" or "2d-1d-1d,1d:1d:1d.1d"
+func ParseDisplayHint(hint string) (*DisplayHint, error) {
+	h := &DisplayHint{text: hint}
+	if hint == "" {
+		return nil, fmt.Errorf("display hint is empty")
+	}
+	if strings.IndexByte("dxob", hint[0]) >= 0 {
+		h.format = hint[0]
+		rest := hint[1:]
+		if rest == "" {
+			return h, nil
+		}
+		if h.format != 'd' || rest[0] != '-' {
+			return nil, fmt.Errorf("invalid integer display hint %q", hint)
+		}
+		n, err := strconv.Atoi(rest[1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid decimal places in display hint %q", hint)
+		}
+		h.decimals = n
+		return h, nil
+	}
+
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	//a separator or terminator is any character that cannot start the next specification
+	isPunctuation := func(i int) bool { return i < len(hint) && hint[i] != '*' && !isDigit(hint[i]) }
+
+	for i := 0; i < len(hint); {
+		spec := octetFormat{}
+		if hint[i] == '*' {
+			spec.repeat = true
+			i++
+		}
+		start := i
+		for i < len(hint) && isDigit(hint[i]) {
+			i++
+		}
+		if start == i {
+			return nil, fmt.Errorf("missing octet length at %d in display hint %q", i, hint)
+		}
+		length, err := strconv.Atoi(hint[start:i])
+		if err != nil || length == 0 {
+			return nil, fmt.Errorf("invalid octet length at %d in display hint %q", start, hint)
+		}
+		spec.length = length
+		if i == len(hint) || strings.IndexByte("dxoat", hint[i]) < 0 {
+			return nil, fmt.Errorf("missing format at %d in display hint %q", i, hint)
+		}
+		spec.format = hint[i]
+		if spec.format != 'a' && spec.format != 't' && spec.length > 8 {
+			//numbers are accumulated in a uint64
+			return nil, fmt.Errorf("octet length %d is too long for a number in display hint %q", spec.length, hint)
+		}
+		i++
+		if isPunctuation(i) {
+			spec.separator = hint[i]
+			i++
+			if spec.repeat && isPunctuation(i) {
+				spec.terminator = hint[i]
+				i++
+			}
+		}
+		h.octets = append(h.octets, spec)
+	}
+	return h, nil
+}
+
+func (h *DisplayHint) String() string {
+	return h.text
+}
+
+// IsInteger reports whether h formats an INTEGER rather than an OCTET STRING
+func (h *DisplayHint) IsInteger() bool {
+	return h.format != 0
+}
+
+// IsDecimal reports whether h renders an integer as a plain or scaled number
+func (h *DisplayHint) IsDecimal() bool {
+	return h.format == 'd'
+}
+
+// FormatInteger renders n, inserting the implied decimal point of "d-n" hints
+func (h *DisplayHint) FormatInteger(n int64) string {
+	switch h.format {
+	case 'x':
+		return strconv.FormatInt(n, 16)
+	case 'o':
+		return strconv.FormatInt(n, 8)
+	case 'b':
+		return strconv.FormatInt(n, 2)
+	}
+	s := strconv.FormatInt(n, 10)
+	if h.decimals == 0 {
+		return s
+	}
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= h.decimals {
+		s = strings.Repeat("0", h.decimals-len(s)+1) + s
+	}
+	point := len(s) - h.decimals
+	return sign + s[:point] + "." + s[point:]
+}
+
+// FormatOctets renders b applying each specification in turn, with the last
+// one repeating until b is used up
+func (h *DisplayHint) FormatOctets(b []byte) string {
+	if len(h.octets) == 0 {
+		return string(b)
+	}
+	sb := strings.Builder{}
+	for i := 0; len(b) > 0; i = min(i+1, len(h.octets)-1) {
+		spec := h.octets[i]
+		repeat := 1
+		if spec.repeat {
+			repeat = int(b[0])
+			b = b[1:]
+		}
+		for ; repeat > 0 && len(b) > 0; repeat-- {
+			n := min(spec.length, len(b))
+			spec.formatOne(&sb, b[:n])
+			b = b[n:]
+			if spec.separator != 0 && len(b) > 0 && (spec.terminator == 0 || repeat > 1) {
+				sb.WriteByte(spec.separator)
+			}
+		}
+		if spec.terminator != 0 && len(b) > 0 {
+			sb.WriteByte(spec.terminator)
+		}
+	}
+	return sb.String()
+}
+
+func (spec *octetFormat) formatOne(sb *strings.Builder, b []byte) {
+	switch spec.format {
+	case 'a':
+		sb.Write(b)
+		return
+	case 't':
+		if utf8.Valid(b) {
+			sb.Write(b)
+		} else {
+			sb.WriteString(strings.ToValidUTF8(string(b), string(utf8.RuneError)))
+		}
+		return
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	switch spec.format {
+	case 'x':
+		fmt.Fprintf(sb, "%0*x", 2*len(b), n)
+	case 'o':
+		sb.WriteString(strconv.FormatUint(n, 8))
+	default:
+		sb.WriteString(strconv.FormatUint(n, 10))
+	}
+}
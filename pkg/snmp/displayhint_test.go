@@ -0,0 +1,201 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+func TestDisplayHintOctets(t *testing.T) {
+	tests := []struct {
+		name string
+		hint string
+		data []byte
+		want string
+	}{
+		{"DisplayString", "255a", []byte("eth0"), "eth0"},
+		{"MacAddress", "1x:", []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, "00:11:22:33:44:55"},
+		{"InetAddressIPv4", "1d.1d.1d.1d", []byte{192, 168, 1, 1}, "192.168.1.1"},
+		{"InetAddressIPv6", "2x:2x:2x:2x:2x:2x:2x:2x", []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "fe80:0000:0000:0000:0000:0000:0000:0001"},
+		{"InetAddressIPv4z", "1d.1d.1d.1d%4d", []byte{10, 0, 0, 1, 0, 0, 0, 3}, "10.0.0.1%3"},
+		{"DateAndTime", "2d-1d-1d,1d:1d:1d.1d,1a1d:1d", []byte{0x07, 0xea, 10, 17, 13, 30, 15, 0}, "2026-10-17,13:30:15.0"},
+		{"DateAndTime with zone", "2d-1d-1d,1d:1d:1d.1d,1a1d:1d", []byte{0x07, 0xea, 10, 17, 13, 30, 15, 0, '+', 2, 0}, "2026-10-17,13:30:15.0,+2:0"},
+		{"last repeats", "1d.", []byte{1, 2, 3}, "1.2.3"},
+		{"repeat count and terminator", "*1d./1d", []byte{3, 1, 2, 3, 9}, "1.2.3/9"},
+		{"octal", "1o", []byte{8}, "10"},
+		{"multi octet decimal", "4d", []byte{0, 1, 0, 0}, "65536"},
+		{"utf8", "255t", []byte("café"), "café"},
+		{"short data", "2x", []byte{0xab}, "ab"},
+		{"eight octet decimal", "8d", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint, err := ParseDisplayHint(tt.hint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := hint.FormatOctets(tt.data)
+			if got != tt.want {
+				t.Errorf("%q formatted %v as %q, want %q", tt.hint, tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayHintInteger(t *testing.T) {
+	tests := []struct {
+		hint string
+		n    int64
+		want string
+	}{
+		{"d", 42, "42"},
+		{"d-2", 1234, "12.34"},
+		{"d-2", -5, "-0.05"},
+		{"d-3", 5, "0.005"},
+		{"d-1", -120, "-12.0"},
+		{"x", 255, "ff"},
+		{"o", 8, "10"},
+		{"b", 5, "101"},
+	}
+	for _, tt := range tests {
+		hint, err := ParseDisplayHint(tt.hint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := hint.FormatInteger(tt.n)
+		if got != tt.want {
+			t.Errorf("%q formatted %d as %q, want %q", tt.hint, tt.n, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "d-", "x-2", "d+1", "1q", "*x", "1", "0a", "*0x", "1d.0a", "9d", "16x", "9o"} {
+		_, err := ParseDisplayHint(invalid)
+		if err == nil {
+			t.Errorf("%q was accepted", invalid)
+		}
+	}
+}
+
+// textualConventionMacro is TEXTUAL-CONVENTION from SNMPv2-TC
+const textualConventionMacro = `
+TEXTUAL-CONVENTION MACRO ::=
+BEGIN
+    TYPE NOTATION ::=
+                  DisplayPart
+                  "STATUS" Status
+                  "DESCRIPTION" Text
+                  ReferPart
+                  "SYNTAX" Syntax
+    VALUE NOTATION ::=
+                  value(VALUE Syntax)
+    DisplayPart ::=
+                  "DISPLAY-HINT" Text
+                | empty
+    Status ::=
+                  "current"
+                | "deprecated"
+                | "obsolete"
+    ReferPart ::=
+                  "REFERENCE" Text
+                | empty
+    Text ::= value(IA5String)
+    Syntax ::=
+                  type
+                | "BITS" "{" NamedBits "}"
+    NamedBits ::= NamedBit
+                | NamedBits "," NamedBit
+    NamedBit ::=  identifier "(" number ")"
+END
+`
+
+const hintTestMib = `HINT-TEST-MIB DEFINITIONS ::= BEGIN
+
+ObjectName ::= OBJECT IDENTIFIER
+` + textualConventionMacro + `
+DateAndTime ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "2d-1d-1d,1d:1d:1d.1d,1a1d:1d"
+    STATUS current
+    DESCRIPTION "a date"
+    SYNTAX OCTET STRING (SIZE (8 | 11))
+
+Hundredths ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "d-2"
+    STATUS current
+    DESCRIPTION "a scaled value"
+    SYNTAX INTEGER
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "a table"
+    ::= { test 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX TestEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "a row"
+    INDEX { testIndex }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE {
+    testIndex INTEGER,
+    testSince DateAndTime,
+    testTemp Hundredths
+}
+
+testIndex OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "index"
+    ::= { testEntry 1 }
+
+testSince OBJECT-TYPE
+    SYNTAX DateAndTime
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "since"
+    ::= { testEntry 2 }
+
+testTemp OBJECT-TYPE
+    SYNTAX Hundredths
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "temperature"
+    ::= { testEntry 3 }
+
+END
+`
+
+func TestPrintDisplayHints(t *testing.T) {
+	db := loadTestMib(t, "HINT-TEST-MIB", hintTestMib)
+	buffer := &bytes.Buffer{}
+	printer := NewMetricPrinter(buffer, db)
+
+	entry := asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 1}
+	varBinds := []VarBind{
+		{OID: append(append(asn1go.OID{}, entry...), 2, 1), Value: NewOctetString([]byte{0x07, 0xea, 10, 17, 13, 30, 15, 0})},
+		{OID: append(append(asn1go.OID{}, entry...), 3, 1), Value: NewInteger32(2150)},
+	}
+	for i := range varBinds {
+		err := printer.Handle(context.Background(), &varBinds[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := printer.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `test_temp{index="1",since="2026-10-17,13:30:15.0"} 21.5`
+	if !strings.Contains(buffer.String(), want) {
+		t.Errorf("got %s, want %s", buffer.String(), want)
+	}
+}
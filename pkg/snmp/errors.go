@@ -0,0 +1,109 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+type ErrorStatus int
+
+const (
+	NoError ErrorStatus = iota
+	TooBig
+	NoSuchName
+	BadValue
+	ReadOnly
+	GenErr
+	NoAccess
+	WrongType
+	WrongLength
+	WrongEncoding
+	WrongValue
+	NoCreation
+	InconsistentValue
+	ResourceUnavailable
+	CommitFailed
+	UndoFailed
+	AuthorizationError
+	NotWritable
+	InconsistentName
+)
+
+var errorStatusNames = []string{
+	"noError",
+	"tooBig",
+	"noSuchName",
+	"badValue",
+	"readOnly",
+	"genErr",
+	"noAccess",
+	"wrongType",
+	"wrongLength",
+	"wrongEncoding",
+	"wrongValue",
+	"noCreation",
+	"inconsistentValue",
+	"resourceUnavailable",
+	"commitFailed",
+	"undoFailed",
+	"authorizationError",
+	"notWritable",
+	"inconsistentName",
+}
+
+func (s ErrorStatus) String() string {
+	if s >= 0 && int(s) < len(errorStatusNames) {
+		return errorStatusNames[s]
+	}
+	return fmt.Sprintf("errorStatus(%d)", int(s))
+}
+
+// PDUError reports a non zero error-status returned by an agent.
+type PDUError struct {
+	Status ErrorStatus
+	Index  int
+	OID    asn1go.OID
+}
+
+func (e *PDUError) Error() string {
+	if len(e.OID) > 0 {
+		return fmt.Sprintf("snmp error %s at index %d (%s)", e.Status, e.Index, e.OID)
+	}
+	return fmt.Sprintf("snmp error %s at index %d", e.Status, e.Index)
+}
+
+// CheckPDU returns a *PDUError if the pdu carries a non zero error-status.
+func CheckPDU(pdu *PDU) error {
+	if pdu.ErrorStatus == 0 {
+		return nil
+	}
+	e := &PDUError{
+		Status: ErrorStatus(pdu.ErrorStatus),
+		Index:  pdu.ErrorIndex,
+	}
+	if pdu.ErrorIndex > 0 && pdu.ErrorIndex <= len(pdu.VarBinds) {
+		e.OID = pdu.VarBinds[pdu.ErrorIndex-1].OID
+	}
+	return e
+}
+
+// IsErrorStatus reports whether err is a *PDUError with the given status.
+func IsErrorStatus(err error, status ErrorStatus) bool {
+	var pduErr *PDUError
+	if errors.As(err, &pduErr) {
+		return pduErr.Status == status
+	}
+	return false
+}
+
+var ErrNonIncreasingOID = errors.New("agent returned a non increasing OID")
+
+var (
+	ErrUnknownObject = errors.New("unknown object")
+	ErrNotWritable   = errors.New("object is not writable")
+	ErrWrongType     = errors.New("wrong type")
+	ErrWrongValue    = errors.New("wrong value")
+	ErrWrongLength   = errors.New("wrong length")
+)
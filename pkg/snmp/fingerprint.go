@@ -0,0 +1,193 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// enterprisesOID is iso.org.dod.internet.private.enterprises, the parent
+// of every vendor's sysObjectID
+var enterprisesOID = asn1go.OID{1, 3, 6, 1, 4, 1}
+
+// enterpriseVendors names the vendors behind common IANA private enterprise
+// numbers, so devices can be grouped without their vendor's MIBs
+var enterpriseVendors = map[int]string{
+	2:     "IBM",
+	9:     "Cisco",
+	11:    "HP",
+	171:   "D-Link",
+	311:   "Microsoft",
+	674:   "Dell",
+	1916:  "Extreme Networks",
+	1991:  "Brocade",
+	2011:  "Huawei",
+	2021:  "Net-SNMP",
+	2620:  "Check Point",
+	2636:  "Juniper",
+	3375:  "F5",
+	4526:  "Netgear",
+	6027:  "Dell",
+	6574:  "Synology",
+	6876:  "VMware",
+	8072:  "Net-SNMP",
+	11863: "TP-Link",
+	12356: "Fortinet",
+	14823: "Aruba",
+	14988: "MikroTik",
+	24681: "QNAP",
+	25461: "Palo Alto Networks",
+	25506: "H3C",
+	30065: "Arista",
+	41112: "Ubiquiti",
+}
+
+// builtinFingerprints recognise operating systems from sysDescr
+var builtinFingerprints = []FingerprintRule{
+	{SysDescr: `Cisco IOS XE Software`, Vendor: "Cisco", OS: "IOS XE"},
+	{SysDescr: `Cisco IOS XR Software`, Vendor: "Cisco", OS: "IOS XR"},
+	{SysDescr: `Cisco NX-OS`, Vendor: "Cisco", OS: "NX-OS"},
+	{SysDescr: `Cisco Adaptive Security Appliance`, Vendor: "Cisco", OS: "ASA"},
+	{SysDescr: `Cisco (IOS Software|Internetwork Operating System)`, Vendor: "Cisco", OS: "IOS"},
+	{SysDescr: `JUNOS`, Vendor: "Juniper", OS: "Junos"},
+	{SysDescr: `Arista Networks EOS`, Vendor: "Arista", OS: "EOS"},
+	{SysDescr: `^RouterOS (?P<model>\S+)`, Vendor: "MikroTik", OS: "RouterOS"},
+	{SysDescr: `VMware ESXi`, Vendor: "VMware", OS: "ESXi"},
+	{SysDescr: `Software: Windows`, Vendor: "Microsoft", OS: "Windows"},
+	{SysDescr: `^Linux`, OS: "Linux"},
+	{SysDescr: `^FreeBSD`, OS: "FreeBSD"},
+	{SysDescr: `^Darwin`, Vendor: "Apple", OS: "macOS"},
+}
+
+// Fingerprint is what a device is, as far as its system group tells
+type Fingerprint struct {
+	Vendor string
+	Model  string
+	OS     string
+}
+
+// Labels returns the fields that are known, keyed vendor, model and os
+func (f Fingerprint) Labels() map[string]string {
+	labels := make(map[string]string)
+	for name, value := range map[string]string{"vendor": f.Vendor, "model": f.Model, "os": f.OS} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// FingerprintRule classifies devices with a sysObjectID under SysObjectID
+// and a sysDescr matching the regular expression SysDescr, either may be
+// empty. Groups in SysDescr named vendor, model or os fill those fields.
+type FingerprintRule struct {
+	SysObjectID string `yaml:"sys_object_id"`
+	SysDescr    string `yaml:"sys_descr"`
+	Vendor      string `yaml:"vendor"`
+	Model       string `yaml:"model"`
+	OS          string `yaml:"os"`
+}
+
+type fingerprintRule struct {
+	FingerprintRule
+	oid   asn1go.OID
+	descr *regexp.Regexp
+}
+
+// Fingerprinter classifies devices by vendor, model and operating system.
+// Rules are tried in order and each field is taken from the first rule that
+// gives it. Fields still unknown come from the enterprise number of the
+// sysObjectID and, when MIBs are loaded, the name of the sysObjectID.
+type Fingerprinter struct {
+	db    *mibdb.Database
+	rules []*fingerprintRule
+}
+
+// NewFingerprinter tries rules ahead of the built-in ones. db may be nil.
+func NewFingerprinter(db *mibdb.Database, rules ...FingerprintRule) (*Fingerprinter, error) {
+	f := &Fingerprinter{db: db}
+	var errs []error
+	for i, rule := range slices.Concat(rules, builtinFingerprints) {
+		compiled := &fingerprintRule{FingerprintRule: rule}
+		var err error
+		if rule.SysObjectID != "" {
+			compiled.oid, err = resolveOID(db, rule.SysObjectID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fingerprint %d: %v", i+1, err))
+				continue
+			}
+		}
+		if rule.SysDescr != "" {
+			compiled.descr, err = regexp.Compile(rule.SysDescr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fingerprint %d: %v", i+1, err))
+				continue
+			}
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	return f, errors.Join(errs...)
+}
+
+// Identify classifies a device, sysObjectID may be nil if it is not known
+func (f *Fingerprinter) Identify(sysObjectID asn1go.OID, sysDescr string) Fingerprint {
+	var fp Fingerprint
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	for _, rule := range f.rules {
+		if rule.oid != nil && (sysObjectID == nil || !underAny(sysObjectID, []asn1go.OID{rule.oid})) {
+			continue
+		}
+		if rule.oid == nil && rule.descr == nil {
+			continue
+		}
+		if rule.descr != nil {
+			match := rule.descr.FindStringSubmatch(sysDescr)
+			if match == nil {
+				continue
+			}
+			for i, name := range rule.descr.SubexpNames() {
+				switch name {
+				case "vendor":
+					fill(&fp.Vendor, match[i])
+				case "model":
+					fill(&fp.Model, match[i])
+				case "os":
+					fill(&fp.OS, match[i])
+				}
+			}
+		}
+		fill(&fp.Vendor, rule.Vendor)
+		fill(&fp.Model, rule.Model)
+		fill(&fp.OS, rule.OS)
+	}
+
+	if len(sysObjectID) <= len(enterprisesOID) || !sysObjectID[:len(enterprisesOID)].Equal(enterprisesOID) {
+		return fp
+	}
+	enterprise := sysObjectID[:len(enterprisesOID)+1]
+	fill(&fp.Vendor, enterpriseVendors[enterprise[len(enterprise)-1]])
+	if f.db != nil {
+		fill(&fp.Vendor, f.objectName(enterprise))
+		if len(sysObjectID) > len(enterprise) {
+			fill(&fp.Model, f.objectName(sysObjectID))
+		}
+	}
+	return fp
+}
+
+// objectName returns the name of the object at exactly oid, if any
+func (f *Fingerprinter) objectName(oid asn1go.OID) string {
+	branch, tail := f.db.FindOID(oid)
+	if branch == nil || branch.Object() == nil || len(tail) > 0 {
+		return ""
+	}
+	return branch.Object().Name()
+}
@@ -0,0 +1,49 @@
+package snmp
+
+import (
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const fingerprintTestMib = `FINGERPRINT-TEST-MIB DEFINITIONS ::= BEGIN
+
+acme OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+acmeProducts OBJECT IDENTIFIER ::= { acme 1 }
+acmeSwitch24 OBJECT IDENTIFIER ::= { acmeProducts 24 }
+
+END
+`
+
+func TestFingerprinter(t *testing.T) {
+	db := loadTestMib(t, "FINGERPRINT-TEST-MIB", fingerprintTestMib)
+	f, err := NewFingerprinter(db, FingerprintRule{SysObjectID: "acme", SysDescr: `AcmeOS (?P<os>\S+)`, Vendor: "Acme Corp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		sysObjectID asn1go.OID
+		sysDescr    string
+		want        Fingerprint
+	}{
+		{"cisco", asn1go.OID{1, 3, 6, 1, 4, 1, 9, 1, 1208}, "Cisco IOS Software, C2960X Software (C2960X-UNIVERSALK9-M), Version 15.2(2)E7", Fingerprint{Vendor: "Cisco", OS: "IOS"}},
+		{"mikrotik", asn1go.OID{1, 3, 6, 1, 4, 1, 14988, 1}, "RouterOS CCR1009-7G-1C-1S+", Fingerprint{Vendor: "MikroTik", Model: "CCR1009-7G-1C-1S+", OS: "RouterOS"}},
+		{"net-snmp", asn1go.OID{1, 3, 6, 1, 4, 1, 8072, 3, 2, 10}, "Linux switch 5.10", Fingerprint{Vendor: "Net-SNMP", OS: "Linux"}},
+		{"from mibs", asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 24}, "switch", Fingerprint{Vendor: "acme", Model: "acmeSwitch24"}},
+		{"override", asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 24}, "AcmeOS 4.2", Fingerprint{Vendor: "Acme Corp", Model: "acmeSwitch24", OS: "4.2"}},
+		{"unknown", asn1go.OID{1, 3, 6, 1, 4, 1, 424242, 1}, "", Fingerprint{}},
+		{"no sysObjectID", nil, "Hardware: Intel64 Family 6 - Software: Windows Version 6.3", Fingerprint{Vendor: "Microsoft", OS: "Windows"}},
+	}
+	for _, tt := range tests {
+		got := f.Identify(tt.sysObjectID, tt.sysDescr)
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	_, err = NewFingerprinter(nil, FingerprintRule{SysObjectID: "acme"}, FingerprintRule{SysDescr: "("})
+	if err == nil {
+		t.Error("unresolvable and invalid rules were accepted")
+	}
+}
@@ -0,0 +1,576 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// kinds of forward target
+const (
+	ForwardWebhook      = "webhook"
+	ForwardAlertmanager = "alertmanager"
+)
+
+// ForwardTarget is an HTTP endpoint notifications are posted to. Webhooks
+// receive one TrapEvent per notification, Alertmanager receives alerts on
+// its v2 API under URL.
+type ForwardTarget struct {
+	Name         string            `yaml:"name"`
+	Kind         string            `yaml:"kind"` // ForwardWebhook, the default, or ForwardAlertmanager
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Timeout      time.Duration     `yaml:"timeout"`       // per post, default 5s
+	RateLimit    float64           `yaml:"rate_limit"`    // posts per second, excess is dropped, unlimited if zero
+	Burst        int               `yaml:"burst"`         // posts allowed at once when rate limited, default 1
+	QueueSize    int               `yaml:"queue_size"`    // events waiting to be posted before more are dropped, default 100
+	ResolveAfter time.Duration     `yaml:"resolve_after"` // alertmanager only, when alerts end, left to alertmanager if zero
+}
+
+// TrapRule selects notifications and the targets they are sent to. Every
+// condition given must match. Traps and varbinds are given by name or
+// numeric OID and match anything beneath them. Varbind patterns are
+// regular expressions matched against the decoded value or its enumeration
+// name, e.g. "down" or "2" for ifOperStatus.
+type TrapRule struct {
+	Name     string            `yaml:"name"`
+	Traps    []string          `yaml:"traps"`
+	Sources  []string          `yaml:"sources"` // addresses or CIDR prefixes
+	VarBinds map[string]string `yaml:"varbinds"`
+	Targets  []string          `yaml:"targets"`
+	Continue bool              `yaml:"continue"` // try later rules after this one matches
+}
+
+// TrapForwardConfig routes notifications to targets by the first matching
+// rule. Identical notifications from the same source that match the same
+// rule within Dedup of each other are only forwarded once.
+type TrapForwardConfig struct {
+	Rules   []TrapRule      `yaml:"rules"`
+	Targets []ForwardTarget `yaml:"targets"`
+	Dedup   time.Duration   `yaml:"dedup"`
+}
+
+// TrapEvent is a notification with names, enumerations and descriptions
+// taken from the MIBs, as posted to webhooks
+type TrapEvent struct {
+	Rule        string             `json:"rule"`
+	Source      string             `json:"source"`
+	Inform      bool               `json:"inform,omitempty"`
+	Received    time.Time          `json:"received"`
+	UpTime      int64              `json:"uptime"`
+	Trap        string             `json:"trap"`
+	TrapOID     string             `json:"trap_oid"`
+	Description string             `json:"description,omitempty"`
+	VarBinds    []TrapEventVarBind `json:"varbinds"`
+}
+
+type TrapEventVarBind struct {
+	OID         string `json:"oid"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Enum        string `json:"enum,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// TrapForwarder is a NotificationHandler that posts matching notifications
+// to HTTP targets. Posting happens in the background so a slow target does
+// not hold up the receiver, Close waits for queued events to be sent.
+type TrapForwarder struct {
+	db      *mibdb.Database
+	logger  *slog.Logger
+	client  *http.Client
+	rules   []*trapRule
+	targets map[string]*forwardTarget
+	dedup   time.Duration
+	workers sync.WaitGroup
+
+	lock   sync.Mutex
+	closed bool
+	seen   map[string]time.Time
+}
+
+type TrapForwarderOption func(f *TrapForwarder) error
+
+func WithForwarderLogger(logger *slog.Logger) TrapForwarderOption {
+	return func(f *TrapForwarder) error {
+		f.logger = logger
+		return nil
+	}
+}
+
+// WithForwarderHTTPClient sets the client used to post, the default is
+// http.DefaultClient
+func WithForwarderHTTPClient(client *http.Client) TrapForwarderOption {
+	return func(f *TrapForwarder) error {
+		f.client = client
+		return nil
+	}
+}
+
+type varBindMatcher struct {
+	oid     asn1go.OID
+	pattern *regexp.Regexp
+}
+
+type trapRule struct {
+	name     string
+	traps    []asn1go.OID
+	sources  []netip.Prefix
+	varBinds []varBindMatcher
+	targets  []*forwardTarget
+	next     bool
+}
+
+type forwardTarget struct {
+	ForwardTarget
+	queue  chan *TrapEvent
+	bucket *tokenBucket
+}
+
+// NewTrapForwarder checks config against db, which may be nil if only
+// numeric OIDs are used, and starts a worker for each target
+func NewTrapForwarder(config *TrapForwardConfig, db *mibdb.Database, options ...TrapForwarderOption) (*TrapForwarder, error) {
+	f := &TrapForwarder{
+		db:      db,
+		logger:  slog.Default(),
+		client:  http.DefaultClient,
+		targets: make(map[string]*forwardTarget),
+		dedup:   config.Dedup,
+		seen:    make(map[string]time.Time),
+	}
+	for _, option := range options {
+		err := option(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, target := range config.Targets {
+		t, err := newForwardTarget(target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := f.targets[t.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate target %q", t.Name))
+			continue
+		}
+		f.targets[t.Name] = t
+	}
+	for i, rule := range config.Rules {
+		r, err := f.compileRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d (%s): %w", i+1, rule.Name, err))
+			continue
+		}
+		f.rules = append(f.rules, r)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	for _, t := range f.targets {
+		f.workers.Add(1)
+		go f.work(t)
+	}
+	return f, nil
+}
+
+func newForwardTarget(config ForwardTarget) (*forwardTarget, error) {
+	t := &forwardTarget{ForwardTarget: config}
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	if t.URL == "" {
+		return nil, fmt.Errorf("target %q has no url", t.Name)
+	}
+	switch t.Kind {
+	case "":
+		t.Kind = ForwardWebhook
+	case ForwardWebhook:
+	case ForwardAlertmanager:
+		t.URL = strings.TrimSuffix(t.URL, "/") + "/api/v2/alerts"
+	default:
+		return nil, fmt.Errorf("target %q has unknown kind %q, need %s or %s", t.Name, t.Kind, ForwardWebhook, ForwardAlertmanager)
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = 5 * time.Second
+	}
+	if t.QueueSize <= 0 {
+		t.QueueSize = 100
+	}
+	if t.RateLimit < 0 {
+		return nil, fmt.Errorf("target %q has a negative rate limit", t.Name)
+	}
+	if t.RateLimit > 0 {
+		t.bucket = newTokenBucket(t.RateLimit, max(t.Burst, 1))
+	}
+	t.queue = make(chan *TrapEvent, t.QueueSize)
+	return t, nil
+}
+
+// resolveOID accepts a numeric OID or a name from db, optionally followed by
+// more sub identifiers
+func resolveOID(db *mibdb.Database, name string) (asn1go.OID, error) {
+	return asn1go.ParseOID(name, func(s string) (asn1go.OID, error) {
+		if db == nil {
+			return nil, fmt.Errorf("no MIBs to look up %q in", s)
+		}
+		object, ok := db.LookupName(s).(*mibdb.Object)
+		if !ok {
+			return nil, fmt.Errorf("unknown object %q", s)
+		}
+		return object.OID(), nil
+	})
+}
+
+func (f *TrapForwarder) compileRule(rule TrapRule) (*trapRule, error) {
+	r := &trapRule{name: rule.Name, next: rule.Continue}
+	var errs []error
+	for _, name := range rule.Traps {
+		oid, err := resolveOID(f.db, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.traps = append(r.traps, oid)
+	}
+	for _, source := range rule.Sources {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(source)
+			if addrErr != nil {
+				errs = append(errs, fmt.Errorf("invalid source %q", source))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		r.sources = append(r.sources, prefix.Masked())
+	}
+	for name, pattern := range rule.VarBinds {
+		oid, err := resolveOID(f.db, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern for %s: %v", name, err))
+			continue
+		}
+		r.varBinds = append(r.varBinds, varBindMatcher{oid: oid, pattern: re})
+	}
+	if len(rule.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("no targets"))
+	}
+	for _, name := range rule.Targets {
+		t, ok := f.targets[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown target %q", name))
+			continue
+		}
+		r.targets = append(r.targets, t)
+	}
+	return r, errors.Join(errs...)
+}
+
+func (r *trapRule) matches(n *Notification, source netip.Addr, event *TrapEvent) bool {
+	if len(r.traps) > 0 && !underAny(n.TrapOID, r.traps) {
+		return false
+	}
+	if len(r.sources) > 0 && !slices.ContainsFunc(r.sources, func(p netip.Prefix) bool { return p.Contains(source) }) {
+		return false
+	}
+	for _, matcher := range r.varBinds {
+		found := false
+		for i := range n.VarBinds {
+			vb := &event.VarBinds[i]
+			if underAny(n.VarBinds[i].OID, []asn1go.OID{matcher.oid}) && (matcher.pattern.MatchString(vb.Value) || vb.Enum != "" && matcher.pattern.MatchString(vb.Enum)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleNotification queues n for the targets of the rules it matches
+func (f *TrapForwarder) HandleNotification(ctx context.Context, n *Notification) error {
+	source := notificationSource(n)
+	event := f.event(n, source)
+	for _, rule := range f.rules {
+		if !rule.matches(n, source, event) {
+			continue
+		}
+		if !f.duplicate(rule.name, event) {
+			ruleEvent := *event
+			ruleEvent.Rule = rule.name
+			for _, t := range rule.targets {
+				f.enqueue(ctx, t, &ruleEvent)
+			}
+		}
+		if !rule.next {
+			break
+		}
+	}
+	return nil
+}
+
+func notificationSource(n *Notification) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(n.Source.String()); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	addr, _ := netip.ParseAddr(n.Source.String())
+	return addr
+}
+
+// event decodes n using the MIBs, values that can not be decoded are given in hex
+func (f *TrapForwarder) event(n *Notification, source netip.Addr) *TrapEvent {
+	event := &TrapEvent{
+		Source:   source.String(),
+		Inform:   n.Inform,
+		Received: n.Received,
+		UpTime:   n.UpTime,
+		Trap:     OIDName(f.db, n.TrapOID),
+		TrapOID:  n.TrapOID.String(),
+	}
+	if !source.IsValid() {
+		event.Source = n.Source.String()
+	}
+	if object := f.object(n.TrapOID); object != nil {
+		event.Description = description(object)
+	}
+	for i := range n.VarBinds {
+		vb := &n.VarBinds[i]
+		value, valueType, err := DecodeValue(f.db, &vb.Value)
+		if err != nil {
+			value = fmt.Sprintf("%x", vb.Value.Bytes)
+		}
+		e := TrapEventVarBind{
+			OID:   vb.OID.String(),
+			Name:  OIDName(f.db, vb.OID),
+			Type:  valueType.String(),
+			Value: value,
+		}
+		if object := f.object(vb.OID); object != nil {
+			e.Description = description(object)
+			if valueType == IntegerValue {
+				if number, err := strconv.Atoi(value); err == nil {
+					e.Enum = resolveSyntax(f.db, object).enums[number]
+				}
+			}
+		}
+		event.VarBinds = append(event.VarBinds, e)
+	}
+	return event
+}
+
+// object returns the object oid is, or is an instance of
+func (f *TrapForwarder) object(oid asn1go.OID) *mibdb.Object {
+	if f.db == nil {
+		return nil
+	}
+	branch, _ := f.db.FindOID(oid)
+	if branch == nil {
+		return nil
+	}
+	return branch.Object()
+}
+
+// description returns the DESCRIPTION of object on a single line. TRAP-TYPE
+// keeps the quotes of its clauses so they are removed here.
+func description(object *mibdb.Object) string {
+	text := stashString(object.Get("DESCRIPTION"))
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		text = text[1 : len(text)-1]
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// duplicate reports whether the same event has matched rule within the dedup window
+func (f *TrapForwarder) duplicate(rule string, event *TrapEvent) bool {
+	if f.dedup <= 0 {
+		return false
+	}
+	key := &strings.Builder{}
+	fmt.Fprintf(key, "%s|%s|%s", rule, event.Source, event.TrapOID)
+	for _, vb := range event.VarBinds {
+		fmt.Fprintf(key, "|%s=%s", vb.OID, vb.Value)
+	}
+
+	now := time.Now()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for k, expires := range f.seen {
+		if now.After(expires) {
+			delete(f.seen, k)
+		}
+	}
+	if _, ok := f.seen[key.String()]; ok {
+		return true
+	}
+	f.seen[key.String()] = now.Add(f.dedup)
+	return false
+}
+
+func (f *TrapForwarder) enqueue(ctx context.Context, t *forwardTarget, event *TrapEvent) {
+	if t.bucket != nil && !t.bucket.take() {
+		f.logger.WarnContext(ctx, "Notification dropped by rate limit", slog.String("target", t.Name), slog.String("trap", event.Trap), slog.String("source", event.Source))
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return
+	}
+	select {
+	case t.queue <- event:
+	default:
+		f.logger.WarnContext(ctx, "Notification dropped, target queue is full", slog.String("target", t.Name), slog.String("trap", event.Trap), slog.String("source", event.Source))
+	}
+}
+
+func (f *TrapForwarder) work(t *forwardTarget) {
+	defer f.workers.Done()
+	for event := range t.queue {
+		err := f.post(t, event)
+		if err != nil {
+			f.logger.Warn("Failed to forward notification", slog.String("target", t.Name), slog.String("trap", event.Trap), slog.Any("error", err))
+		}
+	}
+}
+
+func (f *TrapForwarder) post(t *forwardTarget, event *TrapEvent) error {
+	var payload any = event
+	if t.Kind == ForwardAlertmanager {
+		payload = []*alertmanagerAlert{newAlertmanagerAlert(event, t.ResolveAfter)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range t.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := f.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", t.URL, response.Status)
+	}
+	return nil
+}
+
+// Close stops accepting notifications and waits for those queued to be posted
+func (f *TrapForwarder) Close() error {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return nil
+	}
+	f.closed = true
+	for _, t := range f.targets {
+		close(t.queue)
+	}
+	f.lock.Unlock()
+	f.workers.Wait()
+	return nil
+}
+
+// alertmanagerAlert is an alert as accepted by POST /api/v2/alerts
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func newAlertmanagerAlert(event *TrapEvent, resolveAfter time.Duration) *alertmanagerAlert {
+	alert := &alertmanagerAlert{
+		Labels: map[string]string{
+			"alertname": invalidLabelChars.ReplaceAllString(event.Trap, "_"),
+			"instance":  event.Source,
+			"trap_oid":  event.TrapOID,
+		},
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("%s from %s", event.Trap, event.Source),
+		},
+		StartsAt: event.Received,
+	}
+	if event.Rule != "" {
+		alert.Labels["rule"] = event.Rule
+	}
+	if event.Description != "" {
+		alert.Annotations["description"] = event.Description
+	}
+	for _, vb := range event.VarBinds {
+		value := vb.Value
+		if vb.Enum != "" {
+			value = vb.Enum
+		}
+		alert.Annotations[invalidLabelChars.ReplaceAllString(vb.Name, "_")] = value
+	}
+	if resolveAfter > 0 {
+		endsAt := event.Received.Add(resolveAfter)
+		alert.EndsAt = &endsAt
+	}
+	return alert
+}
+
+// tokenBucket allows up to burst events at once and rate per second after that
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) take() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+var _ NotificationHandler = &TrapForwarder{}
@@ -0,0 +1,125 @@
+package snmp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const forwardTestMib = `FORWARD-TEST-MIB DEFINITIONS ::= BEGIN
+
+ObjectName ::= OBJECT IDENTIFIER
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testIfIndex OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "the interface"
+    ::= { test 1 }
+
+testIfStatus OBJECT-TYPE
+    SYNTAX INTEGER { up(1), down(2) }
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "the state of
+                 the interface"
+    ::= { test 2 }
+
+testLinkChange TRAP-TYPE
+    ENTERPRISE test
+    VARIABLES { testIfIndex, testIfStatus }
+    DESCRIPTION "a link changed state"
+    ::= 1
+
+END
+`
+
+func TestTrapForwarder(t *testing.T) {
+	db := loadTestMib(t, "FORWARD-TEST-MIB", forwardTestMib)
+
+	lock := sync.Mutex{}
+	bodies := map[string][][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], body)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	config := &TrapForwardConfig{
+		Dedup: time.Minute,
+		Targets: []ForwardTarget{
+			{Name: "hook", URL: server.URL + "/hook"},
+			{Name: "am", Kind: ForwardAlertmanager, URL: server.URL},
+		},
+		Rules: []TrapRule{
+			{Name: "remote", Sources: []string{"10.0.0.0/8"}, Targets: []string{"hook"}},
+			{Name: "down", Traps: []string{"test.0.1"}, Sources: []string{"127.0.0.1"}, VarBinds: map[string]string{"testIfStatus": "^down$"}, Targets: []string{"hook", "am"}},
+		},
+	}
+	forwarder, err := NewTrapForwarder(config, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification := func(status int32) *Notification {
+		return &Notification{
+			Source:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+			Received: time.Now(),
+			TrapOID:  asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 0, 1},
+			VarBinds: []VarBind{
+				{OID: asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 0}, Value: NewInteger32(3)},
+				{OID: asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 2, 0}, Value: NewInteger32(status)},
+			},
+		}
+	}
+	//the repeat is deduplicated and the link coming up matches no rule
+	for _, status := range []int32{2, 2, 1} {
+		err = forwarder.HandleNotification(context.Background(), notification(status))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	forwarder.Close()
+
+	if len(bodies["/hook"]) != 1 || len(bodies["/api/v2/alerts"]) != 1 {
+		t.Fatalf("posted %d events and %d alerts, want 1 of each", len(bodies["/hook"]), len(bodies["/api/v2/alerts"]))
+	}
+	var event TrapEvent
+	err = json.Unmarshal(bodies["/hook"][0], &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Rule != "down" || event.Source != "127.0.0.1" || event.Trap != "testLinkChange" || event.Description != "a link changed state" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	status := event.VarBinds[1]
+	if status.Name != "testIfStatus.0" || status.Value != "2" || status.Enum != "down" || status.Description != "the state of the interface" {
+		t.Errorf("unexpected varbind %+v", status)
+	}
+	var alerts []alertmanagerAlert
+	err = json.Unmarshal(bodies["/api/v2/alerts"][0], &alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Labels["alertname"] != "testLinkChange" || alerts[0].Annotations["testIfStatus_0"] != "down" {
+		t.Errorf("unexpected alerts %+v", alerts)
+	}
+
+	config.Rules = append(config.Rules, TrapRule{Name: "bad", Traps: []string{"noSuchTrap"}, Targets: []string{"missing"}})
+	_, err = NewTrapForwarder(config, db)
+	if err == nil {
+		t.Error("unknown trap and target were accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// takeIndex splits n sub-identifiers off the front of data
+func takeIndex(data asn1go.OID, n int) (asn1go.OID, asn1go.OID, error) {
+	if n < 0 || len(data) < n {
+		return nil, data, asn1error.NewErrorf("index is truncated, need %d sub-identifiers but have %d", n, len(data))
+	}
+	return data[:n], data[n:], nil
+}
+
+// takeVariableIndex splits a length prefixed value off data, or all of data
+// when it is IMPLIED (RFC 2578 section 7.7)
+func takeVariableIndex(data asn1go.OID, implied bool) (asn1go.OID, asn1go.OID, error) {
+	if implied {
+		return data, nil, nil
+	}
+	if len(data) == 0 {
+		return nil, data, asn1error.NewErrorf("index is truncated, missing length")
+	}
+	return takeIndex(data[1:], data[0])
+}
+
+func indexOctets(data asn1go.OID) ([]byte, error) {
+	b := make([]byte, len(data))
+	for i, n := range data {
+		if n < 0 || n > 255 {
+			return nil, asn1error.NewErrorf("index sub-identifier %d is not an octet", n)
+		}
+		b[i] = byte(n)
+	}
+	return b, nil
+}
+
+func formatOctets(meta *MetricMeta, b []byte) string {
+	if meta.hint != nil && !meta.hint.IsInteger() {
+		return meta.hint.FormatOctets(b)
+	}
+	hex := strings.Contains(meta.displayHint, "x")
+	if !hex && !strings.Contains(meta.displayHint, "a") {
+		//no hint, so show text unless it is binary
+		hex = strings.ContainsFunc(string(b), func(r rune) bool {
+			return r == unicode.ReplacementChar || !unicode.IsPrint(r)
+		})
+	}
+	if !hex {
+		return string(b)
+	}
+	sb := strings.Builder{}
+	for i, c := range b {
+		if i > 0 {
+			sb.WriteString(":")
+		}
+		fmt.Fprintf(&sb, "%02x", c)
+	}
+	return sb.String()
+}
+
+// buildUnmarshaller returns a decoder for object as an index column based on
+// its SYNTAX
+func (printer *MetricPrinter) buildUnmarshaller(object *mibdb.Object, implied bool) unmarshallerFunc {
+	s := resolveSyntax(printer.db, object)
+	meta := printer.MetaDataForObject(object, nil)
+
+	switch s.base {
+	case "IpAddress", "NetworkAddress":
+		return func(data asn1go.OID) (Value, asn1go.OID, error) {
+			head, tail, err := takeIndex(data, 4)
+			if err != nil {
+				return Value{}, data, err
+			}
+			b, err := indexOctets(head)
+			if err != nil {
+				return Value{}, data, err
+			}
+			return Value{text: net.IP(b).String()}, tail, nil
+		}
+	case "OCTET STRING", "BITS", "Opaque":
+		fixed := -1
+		if len(s.sizes) > 0 && len(s.sizes[0]) == 1 && s.sizes[0][0].Min == s.sizes[0][0].Max {
+			fixed = int(s.sizes[0][0].Min)
+		}
+		return func(data asn1go.OID) (Value, asn1go.OID, error) {
+			var head, tail asn1go.OID
+			var err error
+			if fixed >= 0 {
+				head, tail, err = takeIndex(data, fixed)
+			} else {
+				head, tail, err = takeVariableIndex(data, implied)
+			}
+			if err != nil {
+				return Value{}, data, err
+			}
+			b, err := indexOctets(head)
+			if err != nil {
+				return Value{}, data, err
+			}
+			return Value{text: formatOctets(meta, b)}, tail, nil
+		}
+	case "OBJECT IDENTIFIER":
+		return func(data asn1go.OID) (Value, asn1go.OID, error) {
+			head, tail, err := takeVariableIndex(data, implied)
+			if err != nil {
+				return Value{}, data, err
+			}
+			return Value{text: OIDName(printer.db, head)}, tail, nil
+		}
+	}
+	//INTEGER and the unsigned types use a single sub-identifier
+	return func(data asn1go.OID) (Value, asn1go.OID, error) {
+		head, tail, err := takeIndex(data, 1)
+		if err != nil {
+			return Value{}, data, err
+		}
+		name, ok := s.enums[head[0]]
+		if ok {
+			return Value{text: name}, tail, nil
+		}
+		if meta.hint != nil && meta.hint.IsInteger() {
+			return Value{text: meta.hint.FormatInteger(int64(head[0]))}, tail, nil
+		}
+		return Value{text: strconv.Itoa(head[0]), numeric: true}, tail, nil
+	}
+}
@@ -0,0 +1,242 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+const indexTestMib = `INDEX-TEST-MIB DEFINITIONS ::= BEGIN
+
+ObjectName ::= OBJECT IDENTIFIER
+IpAddress ::= [APPLICATION 0] IMPLICIT OCTET STRING (SIZE (4))
+DisplayString ::= OCTET STRING (SIZE (0..255))
+MacAddress ::= OCTET STRING (SIZE (6))
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "a table"
+    ::= { test 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX TestEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "a row"
+    INDEX { testAddr, testName, testMac, IMPLIED testTag }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE {
+    testAddr IpAddress,
+    testName DisplayString,
+    testMac MacAddress,
+    testTag OCTET STRING,
+    testValue INTEGER
+}
+
+testAddr OBJECT-TYPE
+    SYNTAX IpAddress
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "addr"
+    ::= { testEntry 1 }
+
+testName OBJECT-TYPE
+    SYNTAX DisplayString
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "name"
+    ::= { testEntry 2 }
+
+testMac OBJECT-TYPE
+    SYNTAX MacAddress
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "mac"
+    ::= { testEntry 3 }
+
+testTag OBJECT-TYPE
+    SYNTAX OCTET STRING
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "tag"
+    ::= { testEntry 4 }
+
+testValue OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "value"
+    ::= { testEntry 5 }
+
+testXTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestXEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "extends testTable"
+    ::= { test 4 }
+
+testXEntry OBJECT-TYPE
+    SYNTAX TestXEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "extends a row"
+    AUGMENTS { testEntry }
+    ::= { testXTable 1 }
+
+TestXEntry ::= SEQUENCE {
+    testXAlias DisplayString,
+    testXCount INTEGER
+}
+
+testXAlias OBJECT-TYPE
+    SYNTAX DisplayString
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "alias"
+    ::= { testXEntry 1 }
+
+testXCount OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "count"
+    ::= { testXEntry 2 }
+
+testKind OBJECT-TYPE
+    SYNTAX INTEGER { local(1), remote(2) }
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "kind"
+    ::= { test 2 }
+
+testRef OBJECT-TYPE
+    SYNTAX OBJECT IDENTIFIER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "ref"
+    ::= { test 3 }
+
+END
+`
+
+func TestUnmarshalIndex(t *testing.T) {
+	db := loadTestMib(t, "INDEX-TEST-MIB", indexTestMib)
+	printer := NewMetricPrinter(&bytes.Buffer{}, db)
+
+	tests := []struct {
+		column  string
+		implied bool
+		data    asn1go.OID
+		want    string
+		tail    int
+	}{
+		{"testAddr", false, asn1go.OID{10, 0, 0, 1, 9}, "10.0.0.1", 1},
+		{"testName", false, asn1go.OID{4, 'e', 't', 'h', '0', 9}, "eth0", 1},
+		{"testMac", false, asn1go.OID{0, 0x11, 0x22, 0x33, 0x44, 0x55}, "00:11:22:33:44:55", 0},
+		{"testTag", true, asn1go.OID{'a', 'b'}, "ab", 0},
+		{"testTag", false, asn1go.OID{2, 1, 2}, "01:02", 0},
+		{"testKind", false, asn1go.OID{2, 7}, "remote", 1},
+		{"testValue", false, asn1go.OID{42}, "42", 0},
+		{"testRef", false, asn1go.OID{3, 2, 5, 4}, "2.5.4", 0},
+		{"testRef", true, asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1}, "testTable", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			object := db.LookupName(tt.column).(*mibdb.Object)
+			value, tail, err := printer.unmarshal(object, tt.data, tt.implied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.text != tt.want || len(tail) != tt.tail {
+				t.Errorf("got %q with %d left, want %q with %d left", value.text, len(tail), tt.want, tt.tail)
+			}
+		})
+	}
+
+	object := db.LookupName("testName").(*mibdb.Object)
+	_, _, err := printer.Unmarshal(object, asn1go.OID{5, 'a'})
+	if err == nil {
+		t.Error("truncated string index was accepted")
+	}
+}
+
+func TestPrintIndexLabels(t *testing.T) {
+	db := loadTestMib(t, "INDEX-TEST-MIB", indexTestMib)
+	buffer := &bytes.Buffer{}
+	printer := NewMetricPrinter(buffer, db)
+
+	oid := asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 1, 5, 192, 168, 1, 1, 2, 'l', 'o', 0, 1, 2, 3, 4, 5, 'x'}
+	err := printer.Handle(context.Background(), &VarBind{OID: oid, Value: NewInteger32(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = printer.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `test_value{addr="192.168.1.1",name="lo",mac="00:01:02:03:04:05",tag="x"} 7`
+	if !strings.Contains(buffer.String(), want) {
+		t.Errorf("got %s, want %s", buffer.String(), want)
+	}
+}
+
+func TestAugments(t *testing.T) {
+	db := loadTestMib(t, "INDEX-TEST-MIB", indexTestMib)
+	row := asn1go.OID{192, 168, 1, 1, 2, 'l', 'o', 0, 1, 2, 3, 4, 5, 'x'}
+	column := func(table, column int) asn1go.OID {
+		oid := asn1go.OID{1, 3, 6, 1, 4, 1, 99999, table, 1, column}
+		return append(oid, row...)
+	}
+	varBinds := []VarBind{
+		{OID: column(1, 5), Value: NewInteger32(7)},
+		{OID: column(4, 1), Value: NewOctetString([]byte("uplink"))},
+		{OID: column(4, 2), Value: NewInteger32(3)},
+	}
+	labels := `addr="192.168.1.1",name="lo",mac="00:01:02:03:04:05",tag="x"`
+
+	tests := []struct {
+		name    string
+		options []MetricPrinterOption
+		want    []string
+	}{
+		{"inherited index", nil, []string{
+			`test_value{` + labels + `} 7`,
+			`test_xcount{` + labels + `,xalias="uplink"} 3`,
+		}},
+		{"joined", []MetricPrinterOption{WithAugmentJoin()}, []string{
+			`test_value{` + labels + `,xalias="uplink"} 7`,
+			`test_xcount{` + labels + `,xalias="uplink"} 3`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			printer := NewMetricPrinter(buffer, db, tt.options...)
+			for i := range varBinds {
+				vb := varBinds[i]
+				err := printer.Handle(context.Background(), &vb)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := printer.Flush(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buffer.String(), want) {
+					t.Errorf("missing %s in\n%s", want, buffer.String())
+				}
+			}
+		})
+	}
+}
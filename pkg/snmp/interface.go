@@ -12,14 +12,24 @@ const (
 	GET_NEXT = asn1binary.Tag(0x21)
 	GET_BULK = asn1binary.Tag(0x25)
 	SET      = asn1binary.Tag(0x23)
-	TRAP     = asn1binary.Tag(0x24)
+	TRAP     = asn1binary.Tag(0x24) // v1 Trap-PDU
 	INFORM   = asn1binary.Tag(0x26)
 	RESPONSE = asn1binary.Tag(0x22)
+	TRAP_V2  = asn1binary.Tag(0x27) // SNMPv2-Trap-PDU
+)
+
+// exception values returned in place of a varbind value (context specific class)
+const (
+	NO_SUCH_OBJECT   = asn1binary.Tag(0x00)
+	NO_SUCH_INSTANCE = asn1binary.Tag(0x01)
+	END_OF_MIB_VIEW  = asn1binary.Tag(0x02)
 )
 
 type Connection interface {
+	Version() int
 	Send(pType asn1binary.Tag, pdu *PDU) error
 	Receive() (*PDU, error)
+	Request(ctx context.Context, pType asn1binary.Tag, pdu *PDU) (*PDU, error)
 	Close() error
 }
 
@@ -38,6 +48,12 @@ func (vb *VarBind) String() string {
 	return vb.OID.String() + ": " + vb.Value.String()
 }
 
+func (vb *VarBind) IsException() bool {
+	return vb.Value.Class == asn1binary.ClassContextSpecific && vb.Value.Tag <= END_OF_MIB_VIEW
+}
+
+// PDU is shared by all request types. For GET_BULK the ErrorStatus and
+// ErrorIndex fields carry non-repeaters and max-repetitions respectively.
 type PDU struct {
 	asn1binary.Envelope
 	RequestID   int
@@ -1,16 +1,26 @@
 package snmp
 
 import (
-	"fmt"
 	"slices"
-	"strings"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
 )
 
 type Table struct {
 	prefix     string
 	metricMeta *MetricMeta
 	index      []MetricName
+	implied    bool // the last index is IMPLIED
 	columns    []*MetricMeta
+	augments   *Table
+}
+
+// base returns the table whose rows this one extends, or itself
+func (t *Table) base() *Table {
+	if t.augments != nil {
+		return t.augments
+	}
+	return t
 }
 
 type MetricFlag uint
@@ -22,15 +32,28 @@ const (
 
 type MetricMeta struct {
 	name        MetricName
+	oid         asn1go.OID
 	snakeName   string
 	snmpType    string
-	help, Type  string
+	help        string
+	Type        MetricType
 	displayHint string
+	hint        *DisplayHint
 	enums       map[int]string
 	table       *Table
 	flags       MetricFlag
 }
 
+// family starts a metric family for meta's samples
+func (meta *MetricMeta) family(labelNames []string) *MetricFamily {
+	return &MetricFamily{
+		Name:       meta.snakeName,
+		Help:       meta.help,
+		Type:       meta.Type,
+		LabelNames: labelNames,
+	}
+}
+
 func (meta *MetricMeta) IsLabel() bool {
 	return meta.flags&(MetricIsString|MetricIsPartOfIndex) != 0
 }
@@ -42,6 +65,7 @@ type MetricName string
 type Value struct {
 	text    string
 	numeric bool
+	index   asn1go.OID // the sub-identifiers an index value was taken from
 }
 
 type MetricValues struct {
@@ -113,37 +137,72 @@ func findCommonPrefix(a, b string) string {
 	return a[:prefixLen]
 }
 
-func (mb *MetricBlock) LabelMap() map[RowIndex]string {
+type blockLabel struct {
+	name   string
+	column *MetricMeta
+}
+
+// LabelMap returns the label names and, for each row, the labels from the
+// label columns of the block's table and of any related blocks sharing the
+// same rows
+func (mb *MetricBlock) LabelMap(related ...*MetricBlock) ([]string, map[RowIndex]map[string]string) {
+	labels, labelMap := mb.labelMap(nil, related)
+	return labelNames(labels), labelMap
+}
+
+func labelNames(labels []blockLabel) []string {
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.name
+	}
+	return names
+}
+
+func (mb *MetricBlock) labelMap(rules *metricRules, related []*MetricBlock) ([]blockLabel, map[RowIndex]map[string]string) {
 
 	if mb.table == nil {
-		return nil
+		return nil, nil
 	}
 
-	prefixLen := len(mb.table.prefix)
+	blocks := append([]*MetricBlock{mb}, related...)
+	labels := make([]blockLabel, 0, len(mb.table.columns))
+	for _, block := range blocks {
+		prefixLen := len(block.table.prefix)
+		for _, column := range block.table.columns {
+			if !rules.isLabel(column) || len(column.snakeName) < prefixLen {
+				continue
+			}
+			name := rules.labelName(column, column.snakeName[prefixLen:])
+			if slices.ContainsFunc(labels, func(l blockLabel) bool { return l.name == name || l.column == column }) {
+				continue
+			}
+			//only columns that were walked become labels
+			found := slices.ContainsFunc(blocks, func(block *MetricBlock) bool { return block.metrics[column.name] != nil })
+			if found {
+				labels = append(labels, blockLabel{name, column})
+			}
+		}
+	}
 
-	labelMap := make(map[RowIndex]string)
-	sb := &strings.Builder{}
+	labelMap := make(map[RowIndex]map[string]string)
 	for _, index := range mb.rowIndexes {
-		sb.Reset()
-		for j, column := range mb.table.columns {
-			if column.IsLabel() {
-				if j > 0 {
-					sb.WriteString(",")
-				}
-				metrics := mb.metrics[column.name]
+		rowLabels := make(map[string]string, len(labels))
+		for _, l := range labels {
+			var indexValue Value
+			for _, block := range blocks {
+				metrics := block.metrics[l.column.name]
 				if metrics == nil {
 					continue
 				}
-				indexValue, ok := metrics.Values[index]
-				columnName := column.snakeName[prefixLen:]
+				value, ok := metrics.Values[index]
 				if ok {
-					fmt.Fprintf(sb, "%s=%q", columnName, indexValue.text)
-				} else {
-					fmt.Fprintf(sb, "%s=%q", columnName, "")
+					indexValue = value
+					break
 				}
 			}
+			rowLabels[l.name] = indexValue.text
 		}
-		labelMap[index] = sb.String()
+		labelMap[index] = rowLabels
 	}
-	return labelMap
+	return labels, labelMap
 }
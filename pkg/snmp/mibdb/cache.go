@@ -0,0 +1,557 @@
+package mibdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibtoken"
+	"golang.org/x/exp/maps"
+)
+
+// cacheVersion changes whenever the cache layout or what it holds does
+const cacheVersion = 1
+
+// compiledCache is the compiled definitions of every module read, with the
+// hashes of the files they were read from
+type compiledCache struct {
+	Version    int
+	Files      []cacheFile // as added, before any from the search path
+	SearchPath []string
+	Imported   []cacheFile // read from the search path
+	Filenames  []string
+	Modules    []cacheModule
+	// ModuleNames are the modules values belong to, including the built-in
+	ModuleNames []string
+	// Nodes are the values, referred to by index; the first is nil
+	Nodes []cacheNode
+}
+
+type cacheFile struct {
+	Name string
+	FS   bool
+	Hash []byte
+}
+
+type cacheModule struct {
+	Name        string
+	Imports     map[string]cacheReference
+	Exports     []string
+	Definitions map[string]int
+}
+
+type cacheReference struct {
+	Item, Module string
+}
+
+type cacheKind int
+
+const (
+	cacheNil cacheKind = iota
+	cacheString
+	cacheStrings
+	cacheOID
+	cacheObject
+	cacheTypeReference
+	cacheCompositeValue
+	cacheGoString
+	cacheConstantValue
+	cacheValueList
+	cacheValueListPointer
+)
+
+type cacheNode struct {
+	Kind   cacheKind
+	Module int // 1 based index into ModuleNames, 0 for none
+	File   int // 1 based index into Filenames, 0 for none
+	Line   int
+	Column int
+	Text   string
+	// Strings are elements, or the tokens of a constraint
+	Strings []string
+	OID     []int
+	// SequenceOf is set for a SEQUENCE OF type reference
+	SequenceOf bool
+	Fields     map[string]int
+	Items      []int
+	Stash      map[string]int
+}
+
+// SetCacheFile makes CreateIndex load compiled definitions from filename when
+// the MIB files are unchanged since it was written, and write it otherwise
+func (d *Database) SetCacheFile(filename string) {
+	d.cacheFile = filename
+}
+
+func (file mibFile) hash() ([]byte, error) {
+	f, err := file.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func hashFiles(files []mibFile) ([]cacheFile, error) {
+	var hashed []cacheFile
+	for _, file := range files {
+		hash, err := file.hash()
+		if err != nil {
+			return nil, err
+		}
+		hashed = append(hashed, cacheFile{Name: file.name, FS: file.fsys != nil, Hash: hash})
+	}
+	return hashed, nil
+}
+
+// checkFiles returns an error unless files are those cached, with the same
+// content
+func checkFiles(files []mibFile, cached []cacheFile) error {
+	if len(files) != len(cached) {
+		return fmt.Errorf("%d files were cached but there are %d", len(cached), len(files))
+	}
+	for i, file := range files {
+		if file.name != cached[i].Name || (file.fsys != nil) != cached[i].FS {
+			return fmt.Errorf("%s was cached but not added", cached[i].Name)
+		}
+		hash, err := file.hash()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, cached[i].Hash) {
+			return fmt.Errorf("%s has changed", file.name)
+		}
+	}
+	return nil
+}
+
+// saveCache writes the compiled definitions to filename. added are the files
+// before any were imported from the search path.
+func (d *Database) saveCache(filename string, added []mibFile) error {
+	cache := &compiledCache{
+		Version:    cacheVersion,
+		SearchPath: d.searchPath,
+		Nodes:      []cacheNode{{}},
+	}
+	var err error
+	cache.Files, err = hashFiles(added)
+	if err != nil {
+		return err
+	}
+	cache.Imported, err = hashFiles(d.files[len(added):])
+	if err != nil {
+		return err
+	}
+	e := &cacheEncoder{
+		cache:   cache,
+		ids:     make(map[any]int),
+		modules: make(map[*Module]int),
+		files:   make(map[string]int),
+	}
+	for _, name := range sortedKeys(d.modules) {
+		module := d.modules[name]
+		if name == builtInModuleName {
+			continue
+		}
+		cached := cacheModule{
+			Name:        name,
+			Imports:     make(map[string]cacheReference),
+			Definitions: make(map[string]int),
+		}
+		for key, ref := range module.imports {
+			cached.Imports[key] = cacheReference{Item: ref.item, Module: ref.moduleName}
+		}
+		for _, tok := range module.exports {
+			cached.Exports = append(cached.Exports, tok.String())
+		}
+		for _, key := range sortedKeys(module.definitions) {
+			if _, ok := module.definitions[key].(*MacroDefintion); ok {
+				//macros are only needed to read MIBs
+				continue
+			}
+			id, err := e.encode(module.definitions[key])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, key, err)
+			}
+			cached.Definitions[key] = id
+		}
+		cache.Modules = append(cache.Modules, cached)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	//write then rename, so a reader never sees half a cache
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = gob.NewEncoder(f).Encode(cache)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// loadCache reads the compiled definitions from filename if the files they
+// were compiled from have not changed. The database is unchanged on error.
+func (d *Database) loadCache(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cache := &compiledCache{}
+	err = gob.NewDecoder(f).Decode(cache)
+	if err != nil {
+		return err
+	}
+	if cache.Version != cacheVersion {
+		return fmt.Errorf("cache version %d is not %d", cache.Version, cacheVersion)
+	}
+	if !slices.Equal(cache.SearchPath, d.searchPath) {
+		return fmt.Errorf("the search path has changed")
+	}
+	err = checkFiles(d.files, cache.Files)
+	if err != nil {
+		return err
+	}
+	var imported []mibFile
+	for _, file := range cache.Imported {
+		imported = append(imported, mibFile{name: file.Name})
+	}
+	err = checkFiles(imported, cache.Imported)
+	if err != nil {
+		return err
+	}
+
+	dec := &cacheDecoder{
+		cache:   cache,
+		modules: make(map[string]*Module),
+		values:  make([]any, len(cache.Nodes)),
+	}
+	dec.modules[builtInModuleName] = d.modules[builtInModuleName]
+	for _, cached := range cache.Modules {
+		module := &Module{
+			database:    d,
+			name:        cached.Name,
+			imports:     make(map[string]reference),
+			definitions: make(map[string]Definition),
+		}
+		for key, ref := range cached.Imports {
+			module.imports[key] = reference{item: ref.Item, moduleName: ref.Module}
+		}
+		for _, name := range cached.Exports {
+			module.exports = append(module.exports, *mibtoken.New(name, mibtoken.Source{Filename: cached.Name, Line: 1, Column: 1}))
+		}
+		dec.modules[cached.Name] = module
+	}
+	for _, cached := range cache.Modules {
+		module := dec.modules[cached.Name]
+		for key, id := range cached.Definitions {
+			value, err := dec.decode(id)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", cached.Name, key, err)
+			}
+			def, ok := value.(Definition)
+			if !ok {
+				return fmt.Errorf("%s.%s is %T, not a definition", cached.Name, key, value)
+			}
+			module.definitions[key] = def
+		}
+	}
+
+	for name, module := range dec.modules {
+		d.modules[name] = module
+	}
+	d.files = append(d.files, imported...)
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+// ------------------------------------
+
+type cacheEncoder struct {
+	cache   *compiledCache
+	ids     map[any]int
+	modules map[*Module]int
+	files   map[string]int
+}
+
+func (e *cacheEncoder) add(node cacheNode) int {
+	e.cache.Nodes = append(e.cache.Nodes, node)
+	return len(e.cache.Nodes) - 1
+}
+
+func (e *cacheEncoder) module(module *Module) int {
+	if module == nil {
+		return 0
+	}
+	n, ok := e.modules[module]
+	if !ok {
+		e.cache.ModuleNames = append(e.cache.ModuleNames, module.name)
+		n = len(e.cache.ModuleNames)
+		e.modules[module] = n
+	}
+	return n
+}
+
+func (e *cacheEncoder) file(filename string) int {
+	if filename == "" {
+		return 0
+	}
+	n, ok := e.files[filename]
+	if !ok {
+		e.cache.Filenames = append(e.cache.Filenames, filename)
+		n = len(e.cache.Filenames)
+		e.files[filename] = n
+	}
+	return n
+}
+
+func (e *cacheEncoder) encodeList(list ValueList) ([]int, error) {
+	var items []int
+	for _, value := range list {
+		id, err := e.encode(value)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	return items, nil
+}
+
+// encode adds v, and what it refers to, to the nodes and returns its index.
+// Values are added once, so those shared stay shared when decoded.
+func (e *cacheEncoder) encode(v any) (int, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return e.add(cacheNode{Kind: cacheString, Text: v}), nil
+	case []string:
+		return e.add(cacheNode{Kind: cacheStrings, Strings: v}), nil
+	case asn1go.OID:
+		return e.add(cacheNode{Kind: cacheOID, OID: v}), nil
+	case ValueList:
+		items, err := e.encodeList(v)
+		if err != nil {
+			return 0, err
+		}
+		return e.add(cacheNode{Kind: cacheValueList, Items: items}), nil
+	}
+
+	if id, ok := e.ids[v]; ok {
+		return id, nil
+	}
+	id := e.add(cacheNode{})
+	e.ids[v] = id
+
+	var node cacheNode
+	var base *valueBase
+	var err error
+	switch v := v.(type) {
+	case *ValueList:
+		node.Kind = cacheValueListPointer
+		node.Items, err = e.encodeList(*v)
+	case *Object:
+		node = cacheNode{Kind: cacheObject, Text: v.name, Strings: v.elements, OID: v.compiled}
+		base = &v.valueBase
+	case *TypeReference:
+		node = cacheNode{Kind: cacheTypeReference, Text: v.ident.String(), SequenceOf: v.sequenceOf}
+		if v.constraint != nil {
+			copy := mibtoken.NewProjection(v.constraint)
+			node.Strings = []string{}
+			for !copy.IsEOF() {
+				tok, _ := copy.Pop()
+				node.Strings = append(node.Strings, tok.String())
+			}
+		}
+		base = &v.valueBase
+	case *CompositeValue:
+		node = cacheNode{Kind: cacheCompositeValue, Fields: make(map[string]int)}
+		for _, key := range sortedKeys(v.value) {
+			node.Fields[key], err = e.encode(v.value[key])
+			if err != nil {
+				return 0, err
+			}
+		}
+		base = &v.valueBase
+	case *GoValue[string]:
+		node = cacheNode{Kind: cacheGoString, Text: v.value}
+		base = &v.valueBase
+	case *ConstantValue:
+		node = cacheNode{Kind: cacheConstantValue, Strings: v.elements}
+		base = &v.valueBase
+	default:
+		return 0, fmt.Errorf("cannot cache %T", v)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if base != nil {
+		node.Module = e.module(base.module)
+		node.File = e.file(base.source.Filename)
+		node.Line, node.Column = base.source.Line, base.source.Column
+		lock.RLock()
+		stash := maps.Clone(base.Stash)
+		lock.RUnlock()
+		if len(stash) > 0 {
+			node.Stash = make(map[string]int)
+			for _, key := range sortedKeys(stash) {
+				node.Stash[key], err = e.encode(stash[key])
+				if err != nil {
+					return 0, fmt.Errorf("%s: %w", key, err)
+				}
+			}
+		}
+	}
+	e.cache.Nodes[id] = node
+	return id, nil
+}
+
+// ------------------------------------
+
+type cacheDecoder struct {
+	cache   *compiledCache
+	modules map[string]*Module
+	values  []any
+}
+
+func (dec *cacheDecoder) decodeValue(id int) (Value, error) {
+	v, err := dec.decode(id)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	value, ok := v.(Value)
+	if !ok {
+		return nil, fmt.Errorf("node %d is %T, not a value", id, v)
+	}
+	return value, nil
+}
+
+func (dec *cacheDecoder) decodeList(items []int) (ValueList, error) {
+	list := ValueList{}
+	for _, id := range items {
+		value, err := dec.decodeValue(id)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+func (dec *cacheDecoder) decode(id int) (any, error) {
+	if id < 0 || id >= len(dec.cache.Nodes) {
+		return nil, fmt.Errorf("node %d does not exist", id)
+	}
+	if v := dec.values[id]; v != nil {
+		return v, nil
+	}
+	node := &dec.cache.Nodes[id]
+	switch node.Kind {
+	case cacheNil:
+		return nil, nil
+	case cacheString:
+		return node.Text, nil
+	case cacheStrings:
+		return node.Strings, nil
+	case cacheOID:
+		return asn1go.OID(node.OID), nil
+	case cacheValueList:
+		return dec.decodeList(node.Items)
+	case cacheValueListPointer:
+		list := &ValueList{}
+		dec.values[id] = list
+		var err error
+		*list, err = dec.decodeList(node.Items)
+		return list, err
+	}
+
+	source := mibtoken.Source{Line: node.Line, Column: node.Column}
+	if node.File > 0 && node.File <= len(dec.cache.Filenames) {
+		source.Filename = dec.cache.Filenames[node.File-1]
+	}
+	var module *Module
+	if node.Module > 0 && node.Module <= len(dec.cache.ModuleNames) {
+		module = dec.modules[dec.cache.ModuleNames[node.Module-1]]
+		if module == nil {
+			return nil, fmt.Errorf("module %s was not cached", dec.cache.ModuleNames[node.Module-1])
+		}
+	}
+
+	//values are recorded before what they refer to is decoded, so shared
+	//values stay shared
+	var base *valueBase
+	var err error
+	switch node.Kind {
+	case cacheObject:
+		object := &Object{name: node.Text, elements: node.Strings, compiled: node.OID}
+		dec.values[id], base = object, &object.valueBase
+	case cacheTypeReference:
+		ref := &TypeReference{ident: mibtoken.New(node.Text, source), sequenceOf: node.SequenceOf}
+		if node.Strings != nil {
+			//a token at line 0, column 0 is taken to be the end of file
+			position := source
+			if position.IsEOF() {
+				position.Line = 1
+			}
+			ref.constraint = &mibtoken.List{}
+			for _, text := range node.Strings {
+				ref.constraint.AppendTokens(mibtoken.New(text, position))
+			}
+		}
+		dec.values[id], base = ref, &ref.valueBase
+	case cacheCompositeValue:
+		composite := &CompositeValue{value: make(map[string]Value)}
+		dec.values[id], base = composite, &composite.valueBase
+		for key, field := range node.Fields {
+			composite.value[key], err = dec.decodeValue(field)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case cacheGoString:
+		value := &GoValue[string]{value: node.Text}
+		dec.values[id], base = value, &value.valueBase
+	case cacheConstantValue:
+		constant := &ConstantValue{elements: node.Strings}
+		dec.values[id], base = constant, &constant.valueBase
+	default:
+		return nil, fmt.Errorf("node %d has unknown kind %d", id, node.Kind)
+	}
+	base.set(module, nil, source)
+	for key, field := range node.Stash {
+		v, err := dec.decode(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		base.Set(key, v)
+	}
+	return dec.values[id], nil
+}
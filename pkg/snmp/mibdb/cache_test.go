@@ -0,0 +1,120 @@
+package mibdb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// describe summarises a definition the way consumers see it
+func describe(v any, depth int) string {
+	if depth > 6 {
+		return "..."
+	}
+	switch v := v.(type) {
+	case *Object:
+		return fmt.Sprintf("object %s %s %s", v.name, v.compiled, describeStash(v.Stash, depth))
+	case *TypeReference:
+		ranges, size := v.CompileRanges()
+		return fmt.Sprintf("type %s %v %v %v %v %s", v.Name(), v.sequenceOf, v.CompileEnums(), ranges, size, describeStash(v.Stash, depth))
+	case *CompositeValue:
+		var fields []string
+		for _, key := range sortedKeys(v.value) {
+			fields = append(fields, key+"="+describe(v.Get(key), depth+1))
+		}
+		return fmt.Sprintf("composite {%s} %s", strings.Join(fields, " "), describeStash(v.Stash, depth))
+	case *GoValue[string]:
+		return fmt.Sprintf("string %q %s", v.value, describeStash(v.Stash, depth))
+	case *ConstantValue:
+		return fmt.Sprintf("constant %v %s", v.elements, describeStash(v.Stash, depth))
+	case ValueList:
+		var items []string
+		for _, item := range v {
+			items = append(items, describe(item, depth+1))
+		}
+		return "list [" + strings.Join(items, ", ") + "]"
+	case *ValueList:
+		return "*" + describe(*v, depth)
+	default:
+		return fmt.Sprintf("%T %v", v, v)
+	}
+}
+
+func describeStash(stash Stash, depth int) string {
+	var fields []string
+	for _, key := range sortedKeys(stash) {
+		fields = append(fields, key+"="+describe(stash[key], depth+1))
+	}
+	return "[" + strings.Join(fields, " ") + "]"
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"FILES-IMPORTED-MIB.mib": filesImportedMib})
+	cacheFile := filepath.Join(t.TempDir(), "mibs.cache")
+
+	load := func() *Database {
+		db := New(slog.Default())
+		db.SetCacheFile(cacheFile)
+		err := db.AddEmbeddedStandard()
+		if err == nil {
+			err = db.AddDirectory(dir)
+		}
+		if err == nil {
+			err = db.CreateIndex(context.Background())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	cached := func(db *Database) bool {
+		object, _ := db.LookupName("ifIndex").(*Object)
+		return object != nil && object.metaTokens == nil
+	}
+
+	parsed := load()
+	if cached(parsed) {
+		t.Fatal("the first load was from the cache")
+	}
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded := load()
+	if !cached(loaded) {
+		t.Fatal("the second load was not from the cache")
+	}
+	for name, def := range parsed.definitions {
+		if _, ok := def.(*MacroDefintion); ok {
+			continue
+		}
+		want, got := describe(def, 0), describe(loaded.definitions[name], 0)
+		if want != got {
+			t.Errorf("%s is\n%s\nbut was cached as\n%s", name, want, got)
+		}
+	}
+	for _, name := range []string{"ifIndex", "linkDown", "dot1dTpFdbAddress"} {
+		object := loaded.LookupName(name).(*Object)
+		branch, tail := loaded.FindOID(object.OID())
+		if branch.Object() != object || len(tail) != 0 {
+			t.Errorf("%s is not indexed by OID", name)
+		}
+	}
+	tc := loaded.TextualConvention(loaded.LookupName("sysDescr").(*Object))
+	if tc == nil || tc.Get("DISPLAY-HINT") != "255a" {
+		t.Errorf("unexpected sysDescr textual convention %v", tc)
+	}
+
+	writeFiles(t, dir, map[string]string{"FILES-IMPORTED-MIB.mib": strings.Replace(filesImportedMib, "99998", "99996", 1)})
+	changed := load()
+	if cached(changed) {
+		t.Fatal("a changed file was loaded from the cache")
+	}
+	if got := changed.LookupName("filesImported").(*Object).OID().String(); got != "1.3.6.1.4.1.99996" {
+		t.Errorf("filesImported is %s", got)
+	}
+}
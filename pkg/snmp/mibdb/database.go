@@ -1,11 +1,11 @@
 package mibdb
 
 import (
+	"cmp"
 	"context"
 	"log/slog"
-	"os"
-	"path"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
@@ -16,7 +16,10 @@ import (
 
 type Database struct {
 	modules     map[string]*Module
-	filenames   []string
+	files       []mibFile
+	searchPath  []string
+	searchIndex map[string]mibFile
+	cacheFile   string
 	root        OidBranch
 	logger      *slog.Logger
 	definitions map[string]Definition
@@ -165,45 +168,17 @@ func New(logger *slog.Logger) *Database {
         
           END
 	`)
+	d.readSMIv2(ctx)
 
 	d.logger.Debug("Built-in MIB loaded")
 
 	return d
 }
 
-func (d *Database) AddFile(filenames ...string) error {
-	for _, filename := range filenames {
-		if !slices.Contains(d.filenames, filename) {
-			d.filenames = append(d.filenames, filename)
-		}
-	}
-	return nil
-}
-
 func (d *Database) Logger() *slog.Logger {
 	return d.logger
 }
 
-func (d *Database) AddDirectory(dir string) error {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		nameL := strings.ToLower(file.Name())
-		if strings.HasSuffix(nameL, ".mib") {
-			err := d.AddFile(path.Join(dir + file.Name()))
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
 func (d *Database) compileValues(ctx context.Context) error {
 	//compile all the values now that we have read them all
 	var errList asn1error.List
@@ -250,11 +225,11 @@ func (d *Database) compileValues(ctx context.Context) error {
 func (d *Database) readDefintions(ctx context.Context) error {
 	var errList asn1error.List
 	progress := true
-	var done []string
+	var done []mibFile
 	for progress {
 		errList = nil
 		progress = false
-		for _, f := range d.filenames {
+		for _, f := range d.files {
 			if slices.Contains(done, f) {
 				continue
 			}
@@ -267,6 +242,10 @@ func (d *Database) readDefintions(ctx context.Context) error {
 			done = append(done, f)
 			progress = true
 		}
+		if d.addImports(done) {
+			progress = true
+			continue
+		}
 		if len(errList) == 0 {
 			break
 		}
@@ -281,6 +260,21 @@ func (d *Database) CreateIndex(ctx context.Context) error {
 
 	ctx = withDepthContect(ctx)
 
+	if d.cacheFile != "" {
+		err := d.loadCache(d.cacheFile)
+		if err == nil {
+			//the built-in definitions are not cached
+			err = d.modules[builtInModuleName].compileValues(ctx)
+		}
+		if err == nil {
+			d.index()
+			d.logger.DebugContext(ctx, "Loaded compiled MIBs from cache", slog.String("filename", d.cacheFile))
+			return nil
+		}
+		d.logger.DebugContext(ctx, "Not using compiled MIB cache", slog.String("filename", d.cacheFile), slog.Any("error", err))
+	}
+	added := slices.Clone(d.files)
+
 	//read all the mibs ( but dont try and compile them yet)
 	err := d.readDefintions(ctx)
 	d.logger.DebugContext(ctx, "Finished reading MIB files", slog.Any("error", err))
@@ -293,8 +287,40 @@ func (d *Database) CreateIndex(ctx context.Context) error {
 		return err
 	}
 
+	d.index()
+	d.logger.DebugContext(ctx, "Finished creating index")
+
+	if d.cacheFile != "" {
+		err = d.saveCache(d.cacheFile, added)
+		if err != nil {
+			d.logger.WarnContext(ctx, "Could not save compiled MIB cache", slog.String("filename", d.cacheFile), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+// index makes the definitions of every module available by name and OID
+func (d *Database) index() {
 	d.definitions = make(map[string]Definition)
 	moduleNames := maps.Keys(d.modules)
+	//sorted so names defined twice resolve the same way every time, with
+	//modules read from files taking precedence over the built-in one and
+	//SMIv2 modules such as IF-MIB over the SMIv1 RFC1213-MIB
+	precedence := func(name string) int {
+		switch {
+		case name == builtInModuleName:
+			return 0
+		case d.modules[name].isSMIv1():
+			return 1
+		}
+		return 2
+	}
+	slices.SortFunc(moduleNames, func(a, b string) int {
+		if c := cmp.Compare(precedence(a), precedence(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
 	for _, moduleName := range moduleNames {
 		module := d.modules[moduleName]
 		for name, def := range module.definitions {
@@ -306,9 +332,45 @@ func (d *Database) CreateIndex(ctx context.Context) error {
 			d.root.addDefinition(oid.compiled, oid)
 		}
 	}
+	d.indexTraps()
+}
 
-	d.logger.DebugContext(ctx, "Finished creating index")
-	return nil
+// indexTraps places TRAP-TYPE definitions in the OID tree where RFC 3584
+// maps them (enterprise.0.specific-trap) so converted v1 traps resolve by name
+func (d *Database) indexTraps() {
+	for name, def := range d.definitions {
+		constant, ok := def.(*ConstantValue)
+		if !ok || len(constant.elements) != 1 {
+			continue
+		}
+		enterprise, ok := constant.Get("ENTERPRISE").([]string)
+		if !ok {
+			continue
+		}
+		specific, err := strconv.Atoi(constant.elements[0])
+		if err != nil {
+			continue
+		}
+		var oid asn1go.OID
+		for _, element := range enterprise {
+			n, err := strconv.Atoi(element)
+			if err == nil {
+				oid = append(oid, n)
+				continue
+			}
+			object, ok := d.definitions[element].(*Object)
+			if !ok {
+				oid = nil
+				break
+			}
+			oid = append(asn1go.OID{}, object.compiled...)
+		}
+		if len(oid) == 0 {
+			continue
+		}
+		trap := &Object{valueBase: constant.valueBase, name: name, compiled: append(oid, 0, specific)}
+		d.root.addDefinition(trap.compiled, trap)
+	}
 }
 
 func (d *Database) FindOID(oid asn1go.OID) (*OidBranch, asn1go.OID) {
@@ -320,6 +382,31 @@ func (d *Database) LookupName(name string) Definition {
 	return def
 }
 
+// TextualConvention returns the nearest TEXTUAL-CONVENTION the SYNTAX of
+// value is derived from, or nil if it has none. Its DISPLAY-HINT and SYNTAX
+// are available with Get.
+func (d *Database) TextualConvention(value Value) *CompositeValue {
+	syntax := value.Get("SYNTAX")
+	for depth := 0; depth < 32; depth++ {
+		switch current := syntax.(type) {
+		case *CompositeValue:
+			return current
+		case *TypeReference:
+			if slices.Contains(simpleTypeNames, current.Name()) {
+				return nil
+			}
+			def, ok := d.definitions[current.Name()].(Value)
+			if !ok || def == Value(current) {
+				return nil
+			}
+			syntax = def
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
 func (d *Database) MustReadBuiltInValue(ctx context.Context, valueTypeName, text string) Value {
 	r := strings.NewReader(text)
 	s, err := mibtoken.NewScanner(r, mibtoken.WithSource("<built-in>"), mibtoken.WithSkip(mibtoken.WHITESPACE, mibtoken.COMMENT))
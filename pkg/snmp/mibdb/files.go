@@ -0,0 +1,205 @@
+package mibdb
+
+import (
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibtoken"
+)
+
+// mibFile is a MIB file on disk, or in fsys when that is not nil
+type mibFile struct {
+	fsys fs.FS
+	name string
+}
+
+// pointerFS makes an fs.FS comparable
+type pointerFS struct {
+	fs.FS
+}
+
+func (file mibFile) open() (io.ReadCloser, error) {
+	if file.fsys == nil {
+		return os.Open(file.name)
+	}
+	return file.fsys.Open(file.name)
+}
+
+// moduleName returns the name of the first module in the file, or "" if the
+// file does not start with a module definition
+func (file mibFile) moduleName() string {
+	f, err := file.open()
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s, err := newScanner(f, file.name)
+	if err != nil {
+		return ""
+	}
+	name, err := s.Pop()
+	if err != nil || name.Type() != mibtoken.IDENT {
+		return ""
+	}
+	err = mibtoken.ReadExpected(s, "DEFINITIONS", "::=", "BEGIN")
+	if err != nil {
+		return ""
+	}
+	return name.String()
+}
+
+// isMib reports whether the file should be read. A .mib file always is, and
+// a .txt, .my or extension-less file is when it holds a module definition.
+func (file mibFile) isMib() bool {
+	switch strings.ToLower(path.Ext(file.name)) {
+	case ".mib":
+		return true
+	case ".txt", ".my", "":
+		return file.moduleName() != ""
+	}
+	return false
+}
+
+// diskFile returns a function making disk files for names relative to dir
+func diskFile(dir string) func(name string) mibFile {
+	return func(name string) mibFile {
+		return mibFile{name: filepath.Join(dir, filepath.FromSlash(name))}
+	}
+}
+
+// findFiles walks fsys for MIB files whose base name matches pattern, or
+// all MIB files when pattern is empty
+func findFiles(fsys fs.FS, pattern string, newFile func(name string) mibFile) ([]mibFile, error) {
+	var files []mibFile
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if name != "." && strings.HasPrefix(entry.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if pattern != "" {
+			matched, err := path.Match(pattern, entry.Name())
+			if err != nil || !matched {
+				return err
+			}
+		}
+		file := newFile(name)
+		if file.isMib() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (d *Database) addFiles(files ...mibFile) {
+	for _, file := range files {
+		if !slices.Contains(d.files, file) {
+			d.files = append(d.files, file)
+		}
+	}
+}
+
+func (d *Database) AddFile(filenames ...string) error {
+	for _, filename := range filenames {
+		d.addFiles(mibFile{name: filename})
+	}
+	return nil
+}
+
+// AddDirectory adds the MIB files in dir and its subdirectories
+func (d *Database) AddDirectory(dir string) error {
+	files, err := findFiles(os.DirFS(dir), "", diskFile(dir))
+	if err != nil {
+		return err
+	}
+	d.addFiles(files...)
+	return nil
+}
+
+// AddFS adds the MIB files in fsys whose base name matches the glob pattern,
+// walking subdirectories. An empty pattern adds all of them.
+func (d *Database) AddFS(fsys fs.FS, pattern string) error {
+	if !reflect.TypeOf(fsys).Comparable() {
+		//files are compared to avoid adding them twice, which a map based fs.FS would panic on
+		fsys = &pointerFS{fsys}
+	}
+	files, err := findFiles(fsys, pattern, func(name string) mibFile {
+		return mibFile{fsys: fsys, name: name}
+	})
+	if err != nil {
+		return err
+	}
+	d.addFiles(files...)
+	return nil
+}
+
+// AddSearchPath adds directories, like net-snmp's MIBDIRS, to look in for
+// modules that are imported but not added. Only the modules needed are read;
+// earlier directories take precedence.
+func (d *Database) AddSearchPath(dirs ...string) {
+	d.searchPath = append(d.searchPath, dirs...)
+	d.searchIndex = nil
+}
+
+// findModule returns the file in the search path that defines the module
+func (d *Database) findModule(name string) (mibFile, bool) {
+	if d.searchIndex == nil {
+		d.searchIndex = make(map[string]mibFile)
+		for _, dir := range d.searchPath {
+			files, err := findFiles(os.DirFS(dir), "", diskFile(dir))
+			if err != nil {
+				d.logger.Debug("Could not search for MIBs", slog.String("directory", dir), slog.Any("error", err))
+			}
+			for _, file := range files {
+				moduleName := file.moduleName()
+				if _, exists := d.searchIndex[moduleName]; moduleName != "" && !exists {
+					d.searchIndex[moduleName] = file
+				}
+			}
+		}
+	}
+	file, ok := d.searchIndex[name]
+	return file, ok
+}
+
+// addImports adds files from the search path for modules that are imported
+// but neither read nor waiting to be, and reports whether any were added
+func (d *Database) addImports(done []mibFile) bool {
+	if len(d.searchPath) == 0 {
+		return false
+	}
+	pending := make(map[string]bool)
+	for _, file := range d.files {
+		if !slices.Contains(done, file) {
+			pending[file.moduleName()] = true
+		}
+	}
+	added := false
+	for _, module := range d.modules {
+		for _, ref := range module.imports {
+			_, read := d.modules[ref.moduleName]
+			if read || pending[ref.moduleName] {
+				continue
+			}
+			file, ok := d.findModule(ref.moduleName)
+			if ok && !slices.Contains(d.files, file) {
+				d.addFiles(file)
+				pending[ref.moduleName] = true
+				added = true
+			}
+		}
+	}
+	return added
+}
@@ -0,0 +1,134 @@
+package mibdb
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+const filesTestMib = `FILES-TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    enterprises FROM SNMPv2-SMI
+    filesImported FROM FILES-IMPORTED-MIB;
+
+filesTest OBJECT IDENTIFIER ::= { filesImported 1 }
+
+END
+`
+
+const filesImportedMib = `-- a leading comment
+FILES-IMPORTED-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    enterprises FROM SNMPv2-SMI;
+
+filesImported OBJECT IDENTIFIER ::= { enterprises 99998 }
+
+END
+`
+
+const filesUnusedMib = `FILES-UNUSED-MIB DEFINITIONS ::= BEGIN
+
+filesUnused OBJECT IDENTIFIER ::= { 1 3 6 1 4 1 99997 }
+
+END
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = os.WriteFile(filename, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"vendor/FILES-TEST-MIB.my":     filesTestMib,
+		"FILES-IMPORTED-MIB":           filesImportedMib,
+		"README.txt":                   "not a MIB",
+		".hidden/FILES-UNUSED-MIB.mib": filesUnusedMib,
+	})
+	db := New(slog.Default())
+	err := db.AddDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.files) != 2 {
+		t.Fatalf("expected 2 files, got %v", db.files)
+	}
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.LookupName("filesTest") == nil {
+		t.Error("filesTest was not read")
+	}
+}
+
+func TestAddFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/FILES-TEST-MIB.txt":     {Data: []byte(filesTestMib)},
+		"b/FILES-IMPORTED-MIB.txt": {Data: []byte(filesImportedMib)},
+		"b/FILES-UNUSED-MIB.txt":   {Data: []byte(filesUnusedMib)},
+	}
+	db := New(slog.Default())
+	err := db.AddFS(fsys, "FILES-*-MIB.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.files) != 3 {
+		t.Fatalf("expected 3 files, got %v", db.files)
+	}
+	db = New(slog.Default())
+	err = db.AddFS(fsys, "*TEST*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.files) != 1 {
+		t.Fatalf("expected 1 file, got %v", db.files)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeFiles(t, first, map[string]string{
+		"imported.txt":         filesImportedMib,
+		"FILES-UNUSED-MIB.mib": filesUnusedMib,
+	})
+	writeFiles(t, second, map[string]string{
+		"FILES-IMPORTED-MIB.mib": "FILES-IMPORTED-MIB DEFINITIONS ::= BEGIN broken",
+	})
+	testFile := filepath.Join(t.TempDir(), "FILES-TEST-MIB.mib")
+	writeFiles(t, filepath.Dir(testFile), map[string]string{filepath.Base(testFile): filesTestMib})
+
+	db := New(slog.Default())
+	err := db.AddFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AddSearchPath(first, second)
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.modules["FILES-IMPORTED-MIB"]; !ok {
+		t.Error("FILES-IMPORTED-MIB was not loaded from the search path")
+	}
+	if _, ok := db.modules["FILES-UNUSED-MIB"]; ok {
+		t.Error("FILES-UNUSED-MIB was loaded without being imported")
+	}
+	if db.LookupName("filesTest") == nil {
+		t.Error("filesTest was not read")
+	}
+}
@@ -3,7 +3,6 @@ package mibdb
 import (
 	"context"
 	"io"
-	"os"
 	"slices"
 
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1error"
@@ -61,6 +60,12 @@ func (module *Module) Lookup(name string) (Definition, *Module, error) {
 	} else {
 		otherModule, ok = module.database.modules[importFrom.moduleName]
 		if !ok {
+			//the SMI modules are built in, so they need not be on disk
+			builtin := module.database.modules[builtInModuleName]
+			def, ok = builtin.definitions[name]
+			if ok {
+				return def, builtin, nil
+			}
 			return nil, nil, asn1error.NewUnimplementedError("definition %s needs %s which has not been read yet", name, importFrom.moduleName)
 		}
 	}
@@ -119,6 +124,11 @@ func (module *Module) read(ctx context.Context, s mibtoken.Reader) error {
 	if err != nil {
 		return err
 	}
+	return module.readBody(ctx, s)
+}
+
+// readBody reads definitions up to the END of the module
+func (module *Module) readBody(ctx context.Context, s mibtoken.Reader) error {
 	for {
 		name, err := s.Pop()
 		if err != nil {
@@ -145,6 +155,15 @@ func (module *Module) read(ctx context.Context, s mibtoken.Reader) error {
 			if metaTokens.Length() > 0 {
 				Type, _ := metaTokens.LookAhead(0)
 				if Type.String() == "MACRO" {
+					if module.isBuiltInMacro(name.String()) {
+						//the built-in notations already define these macros and
+						//reading them from the files made indexing much slower
+						_, err = mibtoken.ReadBlock(s, "BEGIN", "END")
+						if err != nil {
+							return err
+						}
+						continue
+					}
 					mibMacro := &MacroDefintion{name: name.String()}
 					mibMacro.set(module, metaTokens, *name.Source())
 					err = mibMacro.readDefinition(ctx, module, s)
@@ -205,6 +224,32 @@ func (module *Module) read(ctx context.Context, s mibtoken.Reader) error {
 	}
 }
 
+// isBuiltInMacro reports whether a macro read by module is one the built-in
+// module already defines
+func (module *Module) isBuiltInMacro(name string) bool {
+	if module.name == builtInModuleName {
+		return false
+	}
+	builtin, ok := module.database.modules[builtInModuleName]
+	if !ok {
+		return false
+	}
+	_, ok = builtin.definitions[name].(*MacroDefintion)
+	return ok
+}
+
+// isSMIv1 reports whether module imports from the SMIv1 modules, so its
+// definitions are older than the SMIv2 modules that replaced them
+func (module *Module) isSMIv1() bool {
+	for _, ref := range module.imports {
+		switch ref.moduleName {
+		case "RFC1155-SMI", "RFC-1212", "RFC-1215", "RFC1065-SMI":
+			return true
+		}
+	}
+	return false
+}
+
 func (module *Module) readValue(ctx context.Context, typeName string, s mibtoken.Reader) (Value, error) {
 	valueType, _, err := Lookup[Type](ctx, typeName)
 	if err != nil {
@@ -286,13 +331,13 @@ func newScanner(r io.Reader, sourceName string) (*mibtoken.Scanner, error) {
 	return s, nil
 }
 
-func readModuleFromFile(ctx context.Context, database *Database, filename string) (*Module, error) {
-	f, err := os.Open(filename)
+func readModuleFromFile(ctx context.Context, database *Database, file mibFile) (*Module, error) {
+	f, err := file.open()
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	s, err := newScanner(f, filename)
+	s, err := newScanner(f, file.name)
 	if err != nil {
 		return nil, err
 	}
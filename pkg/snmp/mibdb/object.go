@@ -67,6 +67,14 @@ func (object *Object) Name() string {
 	return object.name
 }
 
+// ModuleName returns the name of the module the object is defined in
+func (object *Object) ModuleName() string {
+	if object.module == nil {
+		return ""
+	}
+	return object.module.Name()
+}
+
 func (object *Object) compileValue(ctx context.Context, module *Module) (Value, error) {
 	err := object.valueBase.compileMeta(ctx)
 	if err != nil {
@@ -31,6 +31,18 @@ func (branch *OidBranch) ChildValues() []*Object {
 	return values
 }
 
+// Children returns the branches below this one in OID order, including
+// those with no object such as the arcs between registration points
+func (branch *OidBranch) Children() []*OidBranch {
+	var children []*OidBranch
+	keys := maps.Keys(branch.children)
+	slices.Sort(keys)
+	for _, key := range keys {
+		children = append(children, branch.children[key])
+	}
+	return children
+}
+
 func (branch *OidBranch) Parent() *OidBranch {
 	return branch.parent
 }
@@ -108,7 +108,10 @@ func (patternSequence *patternSequence) readValue(ctx context.Context, module *M
 			otherComposite, _ := value.(*CompositeValue)
 			if otherComposite != nil {
 				for k, v := range otherComposite.value {
-					composite.value[k] = v
+					//the outer clause wins, so a revision's DESCRIPTION does not replace the module's
+					if _, exists := composite.value[k]; !exists {
+						composite.value[k] = v
+					}
 				}
 			} else if lastName != "" {
 				composite.value[lastName] = value
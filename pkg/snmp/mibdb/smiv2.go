@@ -0,0 +1,442 @@
+package mibdb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibtoken"
+)
+
+// smiDefinitions are the types and registration points of SNMPv2-SMI
+// (RFC 2578) and RFC 1155 that other modules import
+const smiDefinitions = `
+	org            OBJECT IDENTIFIER ::= { iso 3 }
+	dod            OBJECT IDENTIFIER ::= { org 6 }
+	internet       OBJECT IDENTIFIER ::= { dod 1 }
+	directory      OBJECT IDENTIFIER ::= { internet 1 }
+	mgmt           OBJECT IDENTIFIER ::= { internet 2 }
+	mib-2          OBJECT IDENTIFIER ::= { mgmt 1 }
+	transmission   OBJECT IDENTIFIER ::= { mib-2 10 }
+	experimental   OBJECT IDENTIFIER ::= { internet 3 }
+	private        OBJECT IDENTIFIER ::= { internet 4 }
+	enterprises    OBJECT IDENTIFIER ::= { private 1 }
+	security       OBJECT IDENTIFIER ::= { internet 5 }
+	snmpV2         OBJECT IDENTIFIER ::= { internet 6 }
+	snmpDomains    OBJECT IDENTIFIER ::= { snmpV2 1 }
+	snmpProxys     OBJECT IDENTIFIER ::= { snmpV2 2 }
+	snmpModules    OBJECT IDENTIFIER ::= { snmpV2 3 }
+	zeroDotZero    OBJECT IDENTIFIER ::= { 0 0 }
+
+	ObjectName ::= OBJECT IDENTIFIER
+	NotificationName ::= OBJECT IDENTIFIER
+
+	Integer32 ::= INTEGER (-2147483648..2147483647)
+	IpAddress ::= [APPLICATION 0] IMPLICIT OCTET STRING (SIZE (4))
+	Counter32 ::= [APPLICATION 1] IMPLICIT INTEGER (0..4294967295)
+	Gauge32 ::= [APPLICATION 2] IMPLICIT INTEGER (0..4294967295)
+	Unsigned32 ::= [APPLICATION 2] IMPLICIT INTEGER (0..4294967295)
+	TimeTicks ::= [APPLICATION 3] IMPLICIT INTEGER (0..4294967295)
+	Opaque ::= [APPLICATION 4] IMPLICIT OCTET STRING
+	Counter64 ::= [APPLICATION 6] IMPLICIT INTEGER (0..18446744073709551615)
+
+	Counter ::= [APPLICATION 1] IMPLICIT INTEGER (0..4294967295)
+	Gauge ::= [APPLICATION 2] IMPLICIT INTEGER (0..4294967295)
+	NetworkAddress ::= CHOICE { internet IpAddress }
+END
+`
+
+// readSMIv2 adds the SMIv2 macros and the SMI definitions to the built-in
+// module, so MIBs load without SNMPv2-SMI, SNMPv2-TC and SNMPv2-CONF on disk.
+// The notations follow RFC 2578, 2579 and 2580, keeping their left recursive
+// comma separated lists, but repeated clauses such as REVISION, MODULE and
+// VARIATION are written right recursive, and optional module names are spelt
+// out as alternatives so a keyword is not mistaken for one. A module name's
+// OBJECT IDENTIFIER is read as part of the name.
+func (d *Database) readSMIv2(ctx context.Context) {
+	builtin := d.modules[builtInModuleName]
+
+	builtin.definitions["MODULE-IDENTITY"] = d.MustReadMacroDefinition(ctx, "MODULE-IDENTITY", `
+		BEGIN
+			TYPE NOTATION ::=
+						"LAST-UPDATED" Text
+						"ORGANIZATION" Text
+						"CONTACT-INFO" Text
+						"DESCRIPTION" Text
+						RevisionPart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			RevisionPart ::=
+						Revision RevisionPart
+						| empty
+			Revision ::=
+						"REVISION" Text
+						"DESCRIPTION" Text
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["OBJECT-IDENTITY"] = d.MustReadMacroDefinition(ctx, "OBJECT-IDENTITY", `
+		BEGIN
+			TYPE NOTATION ::=
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["TEXTUAL-CONVENTION"] = d.MustReadMacroDefinition(ctx, "TEXTUAL-CONVENTION", `
+		BEGIN
+			TYPE NOTATION ::=
+						DisplayPart
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+						"SYNTAX" Syntax
+
+			VALUE NOTATION ::=
+						value(VALUE Syntax)
+
+			DisplayPart ::=
+						"DISPLAY-HINT" Text
+						| empty
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			Text ::= value(IA5String)
+
+			Syntax ::=
+						type
+						| "BITS" "{" NamedBits "}"
+
+			NamedBits ::= NamedBit
+						| NamedBits "," NamedBit
+
+			NamedBit ::=  identifier "(" number ")"
+		END
+	`)
+
+	builtin.definitions["NOTIFICATION-TYPE"] = d.MustReadMacroDefinition(ctx, "NOTIFICATION-TYPE", `
+		BEGIN
+			TYPE NOTATION ::=
+						ObjectsPart
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+
+			VALUE NOTATION ::=
+						value(VALUE NotificationName)
+
+			ObjectsPart ::=
+						"OBJECTS" "{" Objects "}"
+						| empty
+			Objects ::=
+						Object
+						| Objects "," Object
+			Object ::=
+						value(ObjectName)
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["OBJECT-GROUP"] = d.MustReadMacroDefinition(ctx, "OBJECT-GROUP", `
+		BEGIN
+			TYPE NOTATION ::=
+						ObjectsPart
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			ObjectsPart ::=
+						"OBJECTS" "{" Objects "}"
+			Objects ::=
+						Object
+						| Objects "," Object
+			Object ::=
+						value(ObjectName)
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["NOTIFICATION-GROUP"] = d.MustReadMacroDefinition(ctx, "NOTIFICATION-GROUP", `
+		BEGIN
+			TYPE NOTATION ::=
+						NotificationsPart
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			NotificationsPart ::=
+						"NOTIFICATIONS" "{" Notifications "}"
+			Notifications ::=
+						Notification
+						| Notifications "," Notification
+			Notification ::=
+						value(NotificationName)
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["MODULE-COMPLIANCE"] = d.MustReadMacroDefinition(ctx, "MODULE-COMPLIANCE", `
+		BEGIN
+			TYPE NOTATION ::=
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+						ModulePart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			Status ::=
+						"current"
+						| "deprecated"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			ModulePart ::=
+						Module ModulePart
+						| Module
+
+			Module ::=
+						"MODULE" ModuleBody
+
+			ModuleBody ::=
+						MandatoryPart CompliancePart
+						| Compliances
+						| identifier MandatoryPart CompliancePart
+						| identifier Compliances
+						| empty
+
+			MandatoryPart ::=
+						"MANDATORY-GROUPS" "{" Groups "}"
+			Groups ::=
+						Group
+						| Groups "," Group
+			Group ::=
+						value(OBJECT IDENTIFIER)
+
+			CompliancePart ::=
+						Compliances
+						| empty
+			Compliances ::=
+						Compliance CompliancePart
+			Compliance ::=
+						ComplianceGroup
+						| ComplianceObject
+
+			ComplianceGroup ::=
+						"GROUP" value(OBJECT IDENTIFIER)
+						"DESCRIPTION" Text
+			ComplianceObject ::=
+						"OBJECT" value(ObjectName)
+						SyntaxPart
+						WriteSyntaxPart
+						AccessPart
+						"DESCRIPTION" Text
+
+			SyntaxPart ::=
+						"SYNTAX" Syntax
+						| empty
+			WriteSyntaxPart ::=
+						"WRITE-SYNTAX" Syntax
+						| empty
+			Syntax ::=
+						type
+						| "BITS" "{" NamedBits "}"
+			NamedBits ::= NamedBit
+						| NamedBits "," NamedBit
+			NamedBit ::=  identifier "(" number ")"
+
+			AccessPart ::=
+						"MIN-ACCESS" Access
+						| empty
+			Access ::=
+						"not-accessible"
+						| "accessible-for-notify"
+						| "read-only"
+						| "read-write"
+						| "read-create"
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	builtin.definitions["AGENT-CAPABILITIES"] = d.MustReadMacroDefinition(ctx, "AGENT-CAPABILITIES", `
+		BEGIN
+			TYPE NOTATION ::=
+						"PRODUCT-RELEASE" Text
+						"STATUS" Status
+						"DESCRIPTION" Text
+						ReferPart
+						ModulePart
+
+			VALUE NOTATION ::=
+						value(VALUE OBJECT IDENTIFIER)
+
+			Status ::=
+						"current"
+						| "obsolete"
+
+			ReferPart ::=
+						"REFERENCE" Text
+						| empty
+
+			ModulePart ::=
+						Modules
+						| empty
+			Modules ::=
+						Module Modules
+						| Module
+
+			Module ::=
+						"SUPPORTS" identifier
+						"INCLUDES" "{" Groups "}"
+						VariationPart
+			Groups ::=
+						Group
+						| Groups "," Group
+			Group ::=
+						value(OBJECT IDENTIFIER)
+
+			VariationPart ::=
+						Variation VariationPart
+						| empty
+			Variation ::=
+						"VARIATION" value(ObjectName)
+						SyntaxPart
+						WriteSyntaxPart
+						AccessPart
+						CreationPart
+						DefValPart
+						"DESCRIPTION" Text
+
+			SyntaxPart ::=
+						"SYNTAX" Syntax
+						| empty
+			WriteSyntaxPart ::=
+						"WRITE-SYNTAX" Syntax
+						| empty
+			Syntax ::=
+						type
+						| "BITS" "{" NamedBits "}"
+			NamedBits ::= NamedBit
+						| NamedBits "," NamedBit
+			NamedBit ::=  identifier "(" number ")"
+
+			AccessPart ::=
+						"ACCESS" Access
+						| empty
+			Access ::=
+						"not-implemented"
+						| "accessible-for-notify"
+						| "read-only"
+						| "read-write"
+						| "read-create"
+						| "write-only"
+
+			CreationPart ::=
+						"CREATION-REQUIRES" "{" Cells "}"
+						| empty
+			Cells ::=
+						Cell
+						| Cells "," Cell
+			Cell ::=
+						value(ObjectName)
+
+			DefValPart ::=
+						"DEFVAL" "{" Defvalue "}"
+						| empty
+			Defvalue ::=
+						value(ObjectSyntax)
+						| "{" BitsValue "}"
+			BitsValue ::=
+						BitNames
+						| empty
+			BitNames ::=
+						BitName
+						| BitNames "," BitName
+			BitName ::= identifier
+
+			Text ::= value(IA5String)
+		END
+	`)
+
+	d.MustReadBuiltInDefinitions(ctx, smiDefinitions)
+}
+
+// MustReadBuiltInDefinitions adds definitions, written as in the body of a
+// module, to the built-in module
+func (d *Database) MustReadBuiltInDefinitions(ctx context.Context, text string) {
+	r := strings.NewReader(text)
+	s, err := mibtoken.NewScanner(r, mibtoken.WithSource(builtInModuleName), mibtoken.WithSkip(mibtoken.WHITESPACE, mibtoken.COMMENT))
+	if err != nil {
+		panic(err)
+	}
+	err = d.modules[builtInModuleName].readBody(ctx, s)
+	if err != nil {
+		panic(err)
+	}
+}
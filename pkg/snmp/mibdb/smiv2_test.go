@@ -0,0 +1,292 @@
+package mibdb
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+// smiv2TestMib imports from SNMPv2-SMI, SNMPv2-TC and SNMPv2-CONF without
+// them being loaded
+const smiv2TestMib = `SMIV2-TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, OBJECT-IDENTITY, NOTIFICATION-TYPE,
+    Counter32, Integer32, enterprises
+        FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION
+        FROM SNMPv2-TC
+    MODULE-COMPLIANCE, OBJECT-GROUP, NOTIFICATION-GROUP, AGENT-CAPABILITIES
+        FROM SNMPv2-CONF;
+
+testMIB MODULE-IDENTITY
+    LAST-UPDATED "202601010000Z"
+    ORGANIZATION "net-mapper"
+    CONTACT-INFO "nobody"
+    DESCRIPTION  "the module"
+    REVISION     "202601010000Z"
+    DESCRIPTION  "the first revision"
+    REVISION     "202501010000Z"
+    DESCRIPTION  "a draft"
+    ::= { enterprises 99999 }
+
+TestName ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "32a"
+    STATUS       current
+    DESCRIPTION  "a short name"
+    SYNTAX       OCTET STRING (SIZE (0..32))
+
+testObjects OBJECT-IDENTITY
+    STATUS      current
+    DESCRIPTION "objects"
+    REFERENCE   "nowhere"
+    ::= { testMIB 1 }
+
+testName OBJECT-TYPE
+    SYNTAX      TestName
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "the name"
+    ::= { testObjects 1 }
+
+testCount OBJECT-TYPE
+    SYNTAX      Counter32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "the count"
+    ::= { testObjects 2 }
+
+testLevel OBJECT-TYPE
+    SYNTAX      Integer32 (0..10)
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "the level"
+    ::= { testObjects 3 }
+
+testNotifications OBJECT IDENTIFIER ::= { testMIB 0 }
+
+testRenamed NOTIFICATION-TYPE
+    OBJECTS     { testName, testCount }
+    STATUS      current
+    DESCRIPTION "the name changed"
+    ::= { testNotifications 1 }
+
+testConformance OBJECT IDENTIFIER ::= { testMIB 2 }
+
+testGroup OBJECT-GROUP
+    OBJECTS     { testName, testCount, testLevel }
+    STATUS      current
+    DESCRIPTION "the objects"
+    ::= { testConformance 1 }
+
+testNotificationGroup NOTIFICATION-GROUP
+    NOTIFICATIONS { testRenamed }
+    STATUS      current
+    DESCRIPTION "the notifications"
+    ::= { testConformance 2 }
+
+testCompliance MODULE-COMPLIANCE
+    STATUS      current
+    DESCRIPTION "what to implement"
+    MODULE  -- this module
+        MANDATORY-GROUPS { testGroup }
+        GROUP       testNotificationGroup
+        DESCRIPTION "optional"
+        OBJECT      testLevel
+        MIN-ACCESS  read-only
+        DESCRIPTION "need not be writable"
+    MODULE IF-MIB
+        MANDATORY-GROUPS { ifGeneralInformationGroup }
+    ::= { testConformance 3 }
+
+testCapabilities AGENT-CAPABILITIES
+    PRODUCT-RELEASE "test agent 1.0"
+    STATUS      current
+    DESCRIPTION "what is implemented"
+    SUPPORTS    SMIV2-TEST-MIB
+    INCLUDES    { testGroup }
+    VARIATION   testLevel
+        ACCESS  read-only
+        DESCRIPTION "read only"
+    ::= { testConformance 4 }
+
+END
+`
+
+func TestSMIv2Macros(t *testing.T) {
+	filename := path.Join(t.TempDir(), "SMIV2-TEST-MIB.mib")
+	err := os.WriteFile(filename, []byte(smiv2TestMib), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New(slog.Default())
+	err = db.AddFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object := func(name string) *Object {
+		o, ok := db.LookupName(name).(*Object)
+		if !ok {
+			t.Fatalf("%s is %T, not an object", name, db.LookupName(name))
+		}
+		return o
+	}
+	names := func(o *Object, field string) []string {
+		list, ok := o.Get(field).(*ValueList)
+		if !ok {
+			t.Fatalf("%s %s is %T, not a list", o.Name(), field, o.Get(field))
+		}
+		return list.Names()
+	}
+
+	module := object("testMIB")
+	if !module.OID().Equal(asn1go.OID{1, 3, 6, 1, 4, 1, 99999}) {
+		t.Errorf("testMIB is %s", module.OID())
+	}
+	if module.Get("DESCRIPTION") != "the module" || module.Get("LAST-UPDATED") != "202601010000Z" || module.Get("REVISION") != "202601010000Z" {
+		t.Errorf("unexpected module identity %v", module.Stash)
+	}
+	if object("testObjects").Get("REFERENCE") != "nowhere" {
+		t.Errorf("unexpected object identity %v", object("testObjects").Stash)
+	}
+
+	notification := object("testRenamed")
+	if !notification.OID().Equal(asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 0, 1}) {
+		t.Errorf("testRenamed is %s", notification.OID())
+	}
+	if got := names(notification, "OBJECTS"); !slices.Equal(got, []string{"testName", "testCount"}) {
+		t.Errorf("testRenamed has objects %v", got)
+	}
+	if got := names(object("testGroup"), "OBJECTS"); len(got) != 3 {
+		t.Errorf("testGroup has objects %v", got)
+	}
+	if got := names(object("testNotificationGroup"), "NOTIFICATIONS"); !slices.Equal(got, []string{"testRenamed"}) {
+		t.Errorf("testNotificationGroup has notifications %v", got)
+	}
+	compliance := object("testCompliance")
+	if compliance.Get("DESCRIPTION") != "what to implement" || !slices.Equal(names(compliance, "MANDATORY-GROUPS"), []string{"testGroup"}) {
+		t.Errorf("unexpected compliance %v", compliance.Stash)
+	}
+	if object("testCapabilities").Get("PRODUCT-RELEASE") != "test agent 1.0" {
+		t.Errorf("unexpected capabilities %v", object("testCapabilities").Stash)
+	}
+
+	tc := db.TextualConvention(object("testName"))
+	if tc == nil {
+		t.Fatal("testName has no textual convention")
+	}
+	syntax, _ := tc.Get("SYNTAX").(*TypeReference)
+	if tc.Get("DISPLAY-HINT") != "32a" || syntax == nil || syntax.Name() != "OCTET STRING" {
+		t.Errorf("unexpected textual convention %v", tc.value)
+	}
+	if db.TextualConvention(object("testCount")) != nil {
+		t.Error("Counter32 has a textual convention")
+	}
+}
+
+const augmentsTestMib = `AUGMENTS-TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    OBJECT-TYPE, Integer32, enterprises
+        FROM SNMPv2-SMI;
+
+test OBJECT IDENTIFIER ::= { enterprises 99998 }
+
+testTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "a table"
+    ::= { test 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "a row"
+    INDEX       { testIndex }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE {
+    testIndex Integer32
+}
+
+testIndex OBJECT-TYPE
+    SYNTAX      Integer32 (1..10)
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "the index"
+    ::= { testEntry 1 }
+
+testXTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestXEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "extends testTable"
+    ::= { test 2 }
+
+testXEntry OBJECT-TYPE
+    SYNTAX      TestXEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "extends a row"
+    AUGMENTS    { testEntry }
+    ::= { testXTable 1 }
+
+TestXEntry ::= SEQUENCE {
+    testXCount Integer32
+}
+
+testXCount OBJECT-TYPE
+    SYNTAX      Integer32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "a count"
+    ::= { testXEntry 1 }
+
+END
+`
+
+func TestAugmentsCompiledBaseFirst(t *testing.T) {
+	db := New(slog.Default())
+	err := db.AddFS(fstest.MapFS{"AUGMENTS-TEST-MIB.txt": {Data: []byte(augmentsTestMib)}}, "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withDepthContect(context.Background())
+	err = db.readDefintions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//compile the entry being augmented before the entry that augments it
+	module := db.modules["AUGMENTS-TEST-MIB"]
+	for _, name := range []string{"test", "testTable", "testEntry", "testXTable", "testXEntry"} {
+		value, err := module.definitions[name].(CompilableValue).compileValue(module.withContext(ctx), module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module.definitions[name] = value
+	}
+	err = db.compileValues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.index()
+
+	augments := db.LookupName("testXEntry").(*Object).Get("AUGMENTS")
+	if names, ok := augments.([]string); !ok || !slices.Equal(names, []string{"testEntry"}) {
+		t.Errorf("testXEntry augments %#v", augments)
+	}
+}
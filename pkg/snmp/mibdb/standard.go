@@ -0,0 +1,44 @@
+package mibdb
+
+import (
+	"embed"
+	"io/fs"
+	"slices"
+)
+
+// standardMibs are the core IETF, IANA and IEEE modules, embedded as
+// published. The macros the SMI modules define are replaced by the built-in
+// notations.
+//
+//go:embed standard/*.mib
+var standardMibs embed.FS
+
+var standardFS = func() fs.FS {
+	sub, err := fs.Sub(standardMibs, "standard")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}()
+
+// StandardMibs returns the embedded standard MIB files
+func StandardMibs() fs.FS {
+	return standardFS
+}
+
+// AddEmbeddedStandard adds the embedded standard MIBs, so only vendor MIBs
+// need to be on disk. They are read before any other file, so a module of
+// the same name from a file replaces the embedded one.
+func (d *Database) AddEmbeddedStandard() error {
+	files, err := findFiles(standardFS, "*.mib", func(name string) mibFile {
+		return mibFile{fsys: standardFS, name: name}
+	})
+	if err != nil {
+		return err
+	}
+	files = slices.DeleteFunc(files, func(file mibFile) bool {
+		return slices.Contains(d.files, file)
+	})
+	d.files = append(files, d.files...)
+	return nil
+}
@@ -0,0 +1,150 @@
+package mibdb
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+func TestEmbeddedStandard(t *testing.T) {
+	db := New(slog.Default())
+	err := db.AddEmbeddedStandard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object := func(name string) *Object {
+		o, ok := db.LookupName(name).(*Object)
+		if !ok {
+			t.Fatalf("%s is %T, not an object", name, db.LookupName(name))
+		}
+		return o
+	}
+
+	oids := map[string]asn1go.OID{
+		"sysDescr":            {1, 3, 6, 1, 2, 1, 1, 1},
+		"ifHCInOctets":        {1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 6},
+		"ipAdEntAddr":         {1, 3, 6, 1, 2, 1, 4, 20, 1, 1},
+		"hrStorageUsed":       {1, 3, 6, 1, 2, 1, 25, 2, 3, 1, 6},
+		"hrStorageRam":        {1, 3, 6, 1, 2, 1, 25, 2, 1, 2},
+		"entPhysicalName":     {1, 3, 6, 1, 2, 1, 47, 1, 1, 1, 1, 7},
+		"dot1dTpFdbPort":      {1, 3, 6, 1, 2, 1, 17, 4, 3, 1, 2},
+		"lldpRemSysName":      {1, 0, 8802, 1, 1, 2, 1, 4, 1, 1, 9},
+		"lldpRemTablesChange": {1, 0, 8802, 1, 1, 2, 0, 0, 1},
+	}
+	for name, oid := range oids {
+		if got := object(name).OID(); !got.Equal(oid) {
+			t.Errorf("%s is %s, expected %s", name, got, oid)
+		}
+	}
+
+	list, ok := object("linkDown").Get("OBJECTS").(*ValueList)
+	if !ok || !slices.Equal(list.Names(), []string{"ifIndex", "ifAdminStatus", "ifOperStatus"}) {
+		t.Errorf("unexpected linkDown objects %v", object("linkDown").Get("OBJECTS"))
+	}
+
+	if object("ifIndex").ModuleName() != "IF-MIB" {
+		t.Errorf("ifIndex is from %q", object("ifIndex").ModuleName())
+	}
+
+	tc := db.TextualConvention(object("sysDescr"))
+	if tc == nil || tc.Get("DISPLAY-HINT") != "255a" {
+		t.Errorf("unexpected sysDescr textual convention %v", tc)
+	}
+	tc = db.TextualConvention(object("ifType"))
+	if tc == nil {
+		t.Fatal("ifType has no textual convention")
+	}
+	syntax, _ := tc.Get("SYNTAX").(*TypeReference)
+	if syntax == nil || syntax.CompileEnums()[6] != "ethernetCsmacd" {
+		t.Errorf("unexpected ifType syntax %v", tc.Get("SYNTAX"))
+	}
+}
+
+const smiV1VendorMib = `SMIV1-VENDOR-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    enterprises, Counter      FROM RFC1155-SMI
+    OBJECT-TYPE               FROM RFC-1212
+    DisplayString, ifIndex    FROM RFC1213-MIB;
+
+vendor OBJECT IDENTIFIER ::= { enterprises 99996 }
+
+vendorPortTable OBJECT-TYPE
+    SYNTAX  SEQUENCE OF VendorPortEntry
+    ACCESS  not-accessible
+    STATUS  mandatory
+    DESCRIPTION
+            "Ports by interface."
+    ::= { vendor 1 }
+
+vendorPortEntry OBJECT-TYPE
+    SYNTAX  VendorPortEntry
+    ACCESS  not-accessible
+    STATUS  mandatory
+    DESCRIPTION
+            "A port."
+    INDEX   { ifIndex }
+    ::= { vendorPortTable 1 }
+
+VendorPortEntry ::= SEQUENCE {
+    vendorPortLabel  DisplayString,
+    vendorPortDrops  Counter
+}
+
+vendorPortLabel OBJECT-TYPE
+    SYNTAX  DisplayString
+    ACCESS  read-only
+    STATUS  mandatory
+    DESCRIPTION
+            "The label printed by the port."
+    ::= { vendorPortEntry 1 }
+
+vendorPortDrops OBJECT-TYPE
+    SYNTAX  Counter
+    ACCESS  read-only
+    STATUS  mandatory
+    DESCRIPTION
+            "Frames dropped by the port."
+    ::= { vendorPortEntry 2 }
+
+END
+`
+
+func TestSMIv1Imports(t *testing.T) {
+	db := New(slog.Default())
+	err := db.AddEmbeddedStandard()
+	if err == nil {
+		err = db.AddFS(fstest.MapFS{"SMIV1-VENDOR-MIB.txt": {Data: []byte(smiV1VendorMib)}}, "*.txt")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, module, err := db.modules["SMIV1-VENDOR-MIB"].Lookup("ifIndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, ok := def.(*Object)
+	if !ok || module.Name() != "RFC1213-MIB" || !imported.OID().Equal(asn1go.OID{1, 3, 6, 1, 2, 1, 2, 2, 1, 1}) {
+		t.Errorf("ifIndex imported from RFC1213-MIB is %v from %v", def, module)
+	}
+	if got := db.LookupName("ifIndex").(*Object).ModuleName(); got != "IF-MIB" {
+		t.Errorf("ifIndex is from %q, the SMIv2 IF-MIB should take precedence", got)
+	}
+	if got := db.LookupName("vendorPortDrops").(*Object).OID(); !got.Equal(asn1go.OID{1, 3, 6, 1, 4, 1, 99996, 1, 1, 2}) {
+		t.Errorf("vendorPortDrops is %s", got)
+	}
+}
@@ -36,6 +36,12 @@ func (ref *TypeReference) Name() string {
 	return ref.ident.String()
 }
 
+// SequenceOf reports whether the type is a SEQUENCE OF the named type, as
+// the SYNTAX of a table is
+func (ref *TypeReference) SequenceOf() bool {
+	return ref.sequenceOf
+}
+
 func (ref *TypeReference) Lookup() Definition {
 	def, otherModule, err := ref.module.Lookup(ref.ident.String())
 	_, _ = otherModule, err
@@ -264,6 +270,67 @@ func (ref *TypeReference) CompileEnums() map[int]string {
 	return mapping
 }
 
+// Range is an inclusive bound from a SYNTAX constraint
+type Range struct {
+	Min, Max int64
+}
+
+// CompileRanges returns the bounds of a constraint such as (0..255 | 300) or,
+// with size set, (SIZE (0..255)). nil is returned for no constraint or one
+// that is not a numeric range, such as an enumeration.
+func (ref *TypeReference) CompileRanges() (ranges []Range, size bool) {
+	if ref.constraint == nil {
+		return nil, false
+	}
+	var projection mibtoken.Reader = mibtoken.NewProjection(ref.constraint)
+	peek, err := projection.LookAhead(0)
+	if err != nil {
+		return nil, false
+	}
+	if peek.String() == "SIZE" {
+		projection.Pop()
+		block, err := mibtoken.ReadBlock(projection, "(", ")")
+		if err != nil {
+			return nil, false
+		}
+		projection, size = block, true
+	}
+	readNumber := func() (int64, bool) {
+		tok, err := projection.Pop()
+		if err != nil || tok.Type() != mibtoken.NUMBER {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(tok.String(), 10, 64)
+		return n, err == nil
+	}
+	for !projection.IsEOF() {
+		r := Range{}
+		var ok bool
+		r.Min, ok = readNumber()
+		if !ok {
+			return nil, false
+		}
+		r.Max = r.Min
+		peek, err := projection.LookAhead(0)
+		if err == nil && peek.String() == "." {
+			err = mibtoken.ReadExpected(projection, ".", ".")
+			if err != nil {
+				return nil, false
+			}
+			r.Max, ok = readNumber()
+			if !ok {
+				return nil, false
+			}
+		}
+		ranges = append(ranges, r)
+		peek, err = projection.LookAhead(0)
+		if err == nil && peek.String() == "|" {
+			projection.Pop()
+		}
+	}
+	return ranges, size
+}
+
 func (ref *TypeReference) CompileColumns() ([]string, error) {
 	if ref.constraint == nil {
 		return nil, nil
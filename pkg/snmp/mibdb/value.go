@@ -54,7 +54,9 @@ func (base *valueBase) compileMeta(ctx context.Context) error {
 				case *ConstantValue:
 					base.Set(name, field.elements)
 				case *Object:
-					base.Set(name, field.compiled)
+					//keep the names, such as AUGMENTS { ifEntry }, so the value
+					//does not depend on what has been compiled already
+					base.Set(name, field.elements)
 				case *GoValue[string]:
 					base.Set(name, field.value)
 				case *TypeReference:
@@ -204,6 +206,25 @@ func (list ValueList) compileValue(ctx context.Context, module *Module) (Value,
 	return list, nil
 }
 
+// Names returns the objects in the list by name, such as the OBJECTS of a
+// NOTIFICATION-TYPE
+func (list ValueList) Names() []string {
+	var names []string
+	for _, value := range list {
+		switch value := value.(type) {
+		case *Object:
+			if value.name != "" {
+				names = append(names, value.name)
+			} else {
+				names = append(names, strings.Join(value.elements, "."))
+			}
+		case *ConstantValue:
+			names = append(names, strings.Join(value.elements, "."))
+		}
+	}
+	return names
+}
+
 func (list ValueList) Get(name string) any {
 	return nil
 }
@@ -0,0 +1,281 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+	"golang.org/x/exp/maps"
+)
+
+// how a column is exported
+const (
+	AsLabel = "label"
+	AsInfo  = "info"
+)
+
+// MetricOverride changes how one object is exported
+type MetricOverride struct {
+	Name string `yaml:"name"` // the metric name, or the label name when it is a label
+	As   string `yaml:"as"`   // AsLabel or AsInfo
+}
+
+// MetricLookup labels the rows of tables indexed by SourceIndexes with the
+// value of Lookup from a table indexed by the same values, e.g. ifDescr for
+// tables indexed by ifIndex. The lookup object must be walked too.
+type MetricLookup struct {
+	SourceIndexes     []string `yaml:"source_indexes"`
+	Lookup            string   `yaml:"lookup"`
+	DropSourceIndexes bool     `yaml:"drop_source_indexes"`
+}
+
+// MetricConfig adjusts the names and labels a MetricPrinter derives from the
+// MIBs. Objects are given by name or numeric OID.
+type MetricConfig struct {
+	Keep         []string                   `yaml:"keep"` // objects or subtrees to export metrics for, all if empty
+	Drop         []string                   `yaml:"drop"` // objects or subtrees never exported, not even as labels
+	StringsAs    string                     `yaml:"strings_as"`
+	StaticLabels map[string]string          `yaml:"static_labels"`
+	Lookups      []MetricLookup             `yaml:"lookups"`
+	Overrides    map[string]*MetricOverride `yaml:"overrides"`
+}
+
+// WithMetricConfig applies config to the metrics. Names that cannot be
+// resolved are logged and ignored, use Check to reject them up front.
+func WithMetricConfig(config *MetricConfig) MetricPrinterOption {
+	return func(printer *MetricPrinter) {
+		rules, err := config.compile(printer.db)
+		if err != nil {
+			printer.db.Logger().Warn("Metric config is incomplete", "error", err.Error())
+		}
+		printer.rules = rules
+	}
+}
+
+// Check reports any objects in config that are not in db
+func (config *MetricConfig) Check(db *mibdb.Database) error {
+	_, err := config.compile(db)
+	return err
+}
+
+type metricLookup struct {
+	sources []MetricName
+	lookup  MetricName
+	drop    bool
+}
+
+// metricRules is a MetricConfig resolved against a database. A nil
+// *metricRules exports everything as derived from the MIBs.
+type metricRules struct {
+	keep, drop   []asn1go.OID
+	stringsAs    string
+	overrides    map[string]*MetricOverride // by object name
+	staticLabels map[string]string
+	staticNames  []string
+	lookups      []metricLookup
+}
+
+func resolveObject(db *mibdb.Database, name string) (*mibdb.Object, error) {
+	oid, err := asn1go.ParseOID(name, func(s string) (asn1go.OID, error) {
+		object, ok := db.LookupName(s).(*mibdb.Object)
+		if !ok {
+			return nil, fmt.Errorf("unknown object %q", s)
+		}
+		return object.OID(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	branch, tail := db.FindOID(oid)
+	if branch == nil || branch.Object() == nil || len(tail) > 0 {
+		return nil, fmt.Errorf("%s is not an object", name)
+	}
+	return branch.Object(), nil
+}
+
+func (config *MetricConfig) compile(db *mibdb.Database) (*metricRules, error) {
+	rules := &metricRules{
+		stringsAs:    config.StringsAs,
+		overrides:    make(map[string]*MetricOverride),
+		staticLabels: config.StaticLabels,
+		staticNames:  maps.Keys(config.StaticLabels),
+	}
+	slices.Sort(rules.staticNames)
+	var errs []error
+	resolve := func(name string) *mibdb.Object {
+		object, err := resolveObject(db, name)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return object
+	}
+	checkAs := func(name, as string) {
+		if as != "" && as != AsLabel && as != AsInfo {
+			errs = append(errs, fmt.Errorf("%s can not be exported as %q, need %s or %s", name, as, AsLabel, AsInfo))
+		}
+	}
+
+	checkAs("strings", config.StringsAs)
+	for _, name := range config.Keep {
+		if object := resolve(name); object != nil {
+			rules.keep = append(rules.keep, object.OID())
+		}
+	}
+	for _, name := range config.Drop {
+		if object := resolve(name); object != nil {
+			rules.drop = append(rules.drop, object.OID())
+		}
+	}
+	for name, override := range config.Overrides {
+		checkAs(name, override.As)
+		if object := resolve(name); object != nil {
+			rules.overrides[object.Name()] = override
+		}
+	}
+	for _, lookup := range config.Lookups {
+		compiled := metricLookup{drop: lookup.DropSourceIndexes}
+		ok := true
+		for _, name := range lookup.SourceIndexes {
+			object := resolve(name)
+			if object == nil {
+				ok = false
+				continue
+			}
+			compiled.sources = append(compiled.sources, MetricName(object.Name()))
+		}
+		object := resolve(lookup.Lookup)
+		if object == nil || len(compiled.sources) == 0 {
+			ok = false
+		} else {
+			compiled.lookup = MetricName(object.Name())
+		}
+		if ok {
+			rules.lookups = append(rules.lookups, compiled)
+		}
+	}
+	return rules, errors.Join(errs...)
+}
+
+func underAny(oid asn1go.OID, subtrees []asn1go.OID) bool {
+	return slices.ContainsFunc(subtrees, func(subtree asn1go.OID) bool {
+		return len(oid) >= len(subtree) && oid[:len(subtree)].Equal(subtree)
+	})
+}
+
+func (rules *metricRules) override(meta *MetricMeta) *MetricOverride {
+	if rules == nil {
+		return nil
+	}
+	return rules.overrides[string(meta.name)]
+}
+
+func (rules *metricRules) dropped(meta *MetricMeta) bool {
+	return rules != nil && underAny(meta.oid, rules.drop)
+}
+
+// exported reports whether meta may be a metric or an info metric
+func (rules *metricRules) exported(meta *MetricMeta) bool {
+	if rules == nil {
+		return true
+	}
+	if rules.dropped(meta) {
+		return false
+	}
+	return len(rules.keep) == 0 || underAny(meta.oid, rules.keep)
+}
+
+func (rules *metricRules) as(meta *MetricMeta) string {
+	if override := rules.override(meta); override != nil && override.As != "" {
+		return override.As
+	}
+	if meta.flags&MetricIsPartOfIndex != 0 || meta.flags&MetricIsString == 0 {
+		return ""
+	}
+	if rules == nil {
+		return AsLabel
+	}
+	return rules.stringsAs
+}
+
+func (rules *metricRules) isLabel(meta *MetricMeta) bool {
+	if rules.dropped(meta) {
+		return false
+	}
+	switch rules.as(meta) {
+	case AsLabel:
+		return true
+	case AsInfo:
+		return false
+	}
+	return meta.IsLabel()
+}
+
+func (rules *metricRules) isInfo(meta *MetricMeta) bool {
+	return rules.as(meta) == AsInfo && rules.exported(meta)
+}
+
+func (rules *metricRules) metricName(meta *MetricMeta) string {
+	if override := rules.override(meta); override != nil && override.Name != "" {
+		return override.Name
+	}
+	return meta.snakeName
+}
+
+func (rules *metricRules) labelName(meta *MetricMeta, derived string) string {
+	if override := rules.override(meta); override != nil && override.Name != "" {
+		return override.Name
+	}
+	return derived
+}
+
+// addLookups labels the rows of block from the lookup columns in sources
+func (rules *metricRules) addLookups(block *MetricBlock, sources []*MetricBlock, labels []blockLabel, labelMap map[RowIndex]map[string]string) []blockLabel {
+	if rules == nil || block.table == nil {
+		return labels
+	}
+	for _, lookup := range rules.lookups {
+		if !slices.ContainsFunc(lookup.sources, func(name MetricName) bool { return !slices.Contains(block.table.index, name) }) {
+			labels = lookup.apply(rules, block, sources, labels, labelMap)
+		}
+	}
+	return labels
+}
+
+func (lookup *metricLookup) apply(rules *metricRules, block *MetricBlock, sources []*MetricBlock, labels []blockLabel, labelMap map[RowIndex]map[string]string) []blockLabel {
+	var values *MetricValues
+	for _, source := range sources {
+		if values = source.metrics[lookup.lookup]; values != nil {
+			break
+		}
+	}
+	if values == nil {
+		return labels
+	}
+	name := rules.labelName(values.Meta, values.Meta.snakeName)
+	for _, row := range block.rowIndexes {
+		var key asn1go.OID
+		for _, source := range lookup.sources {
+			if indexValues := block.metrics[source]; indexValues != nil {
+				key = append(key, indexValues.Values[row].index...)
+			}
+		}
+		labelMap[row][name] = values.Values[RowIndex(key.String())].text
+	}
+	if lookup.drop {
+		labels = slices.DeleteFunc(labels, func(l blockLabel) bool {
+			if !slices.Contains(lookup.sources, l.column.name) {
+				return false
+			}
+			for _, rowLabels := range labelMap {
+				delete(rowLabels, l.name)
+			}
+			return true
+		})
+	}
+	if !slices.ContainsFunc(labels, func(l blockLabel) bool { return l.name == name }) {
+		labels = append(labels, blockLabel{name, values.Meta})
+	}
+	return labels
+}
@@ -0,0 +1,197 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const overrideTestMib = `OVERRIDE-TEST-MIB DEFINITIONS ::= BEGIN
+
+ObjectName ::= OBJECT IDENTIFIER
+IpAddress ::= [APPLICATION 0] IMPLICIT OCTET STRING (SIZE (4))
+DisplayString ::= OCTET STRING (SIZE (0..255))
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testIfTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestIfEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "interfaces"
+    ::= { test 1 }
+
+testIfEntry OBJECT-TYPE
+    SYNTAX TestIfEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "an interface"
+    INDEX { testIfIndex }
+    ::= { testIfTable 1 }
+
+TestIfEntry ::= SEQUENCE {
+    testIfIndex INTEGER,
+    testIfDescr DisplayString,
+    testIfInOctets INTEGER,
+    testIfAlias DisplayString
+}
+
+testIfIndex OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "index"
+    ::= { testIfEntry 1 }
+
+testIfDescr OBJECT-TYPE
+    SYNTAX DisplayString
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "descr"
+    ::= { testIfEntry 2 }
+
+testIfInOctets OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "octets"
+    ::= { testIfEntry 3 }
+
+testIfAlias OBJECT-TYPE
+    SYNTAX DisplayString
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "alias"
+    ::= { testIfEntry 4 }
+
+testNbrTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestNbrEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "neighbours"
+    ::= { test 2 }
+
+testNbrEntry OBJECT-TYPE
+    SYNTAX TestNbrEntry
+    ACCESS not-accessible
+    STATUS mandatory
+    DESCRIPTION "a neighbour"
+    INDEX { testNbrIfIndex, testNbrAddr }
+    ::= { testNbrTable 1 }
+
+TestNbrEntry ::= SEQUENCE {
+    testNbrIfIndex INTEGER,
+    testNbrAddr IpAddress,
+    testNbrState INTEGER
+}
+
+testNbrIfIndex OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "interface"
+    ::= { testNbrEntry 1 }
+
+testNbrAddr OBJECT-TYPE
+    SYNTAX IpAddress
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "address"
+    ::= { testNbrEntry 2 }
+
+testNbrState OBJECT-TYPE
+    SYNTAX INTEGER
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "state"
+    ::= { testNbrEntry 3 }
+
+END
+`
+
+func TestMetricConfig(t *testing.T) {
+	db := loadTestMib(t, "OVERRIDE-TEST-MIB", overrideTestMib)
+	column := func(table, column int, index ...int) asn1go.OID {
+		return append(asn1go.OID{1, 3, 6, 1, 4, 1, 99999, table, 1, column}, index...)
+	}
+	varBinds := []VarBind{
+		{OID: column(1, 2, 2), Value: NewOctetString([]byte("eth1"))},
+		{OID: column(1, 3, 2), Value: NewInteger32(100)},
+		{OID: column(1, 4, 2), Value: NewOctetString([]byte("uplink"))},
+		{OID: column(2, 3, 2, 10, 0, 0, 2), Value: NewInteger32(5)},
+	}
+
+	tests := []struct {
+		name    string
+		config  MetricConfig
+		want    []string
+		missing []string
+	}{
+		{"defaults", MetricConfig{}, []string{
+			`test_if_in_octets{index="2",descr="eth1",alias="uplink"} 100`,
+			`test_nbr_state{if_index="2",addr="10.0.0.2"} 5`,
+		}, nil},
+		{"overrides", MetricConfig{
+			StaticLabels: map[string]string{"site": "lab"},
+			Overrides: map[string]*MetricOverride{
+				"testIfInOctets": {Name: "if_received"},
+				"testIfAlias":    {As: AsInfo},
+			},
+			Lookups: []MetricLookup{
+				{SourceIndexes: []string{"testNbrIfIndex"}, Lookup: "testIfDescr", DropSourceIndexes: true},
+			},
+		}, []string{
+			`if_received{index="2",descr="eth1",site="lab"} 100`,
+			`test_if_alias_info{index="2",descr="eth1",site="lab",alias="uplink"} 1`,
+			`test_nbr_state{addr="10.0.0.2",test_if_descr="eth1",site="lab"} 5`,
+		}, nil},
+		{"keep and drop", MetricConfig{
+			Keep: []string{"testNbrTable"},
+			Drop: []string{"1.3.6.1.4.1.99999.2.1.2"},
+		}, []string{
+			`test_nbr_state{if_index="2"} 5`,
+		}, []string{"test_if_"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Check(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buffer := &bytes.Buffer{}
+			printer := NewMetricPrinter(buffer, db, WithMetricConfig(&tt.config))
+			for i := range varBinds {
+				vb := varBinds[i]
+				err := printer.Handle(context.Background(), &vb)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = printer.Flush(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buffer.String(), want) {
+					t.Errorf("missing %s in\n%s", want, buffer.String())
+				}
+			}
+			for _, unwanted := range tt.missing {
+				if strings.Contains(buffer.String(), unwanted) {
+					t.Errorf("unexpected %s in\n%s", unwanted, buffer.String())
+				}
+			}
+		})
+	}
+
+	bad := MetricConfig{
+		Drop:      []string{"noSuchObject"},
+		Overrides: map[string]*MetricOverride{"testIfAlias": {As: "metric"}},
+	}
+	if err := bad.Check(db); err == nil {
+		t.Error("unknown object and export were accepted")
+	}
+}
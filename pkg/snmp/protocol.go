@@ -1,14 +1,18 @@
 package snmp
 
 import (
+	"bufio"
 	"fmt"
+	mathrand "math/rand/v2"
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidjspooner/net-mapper/pkg/asn1"
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
 )
 
 func init() {
@@ -22,6 +26,12 @@ type protocol struct {
 	version        int
 	bufferSize     int
 	receiveTimeout time.Duration
+	retries        int
+	backoff        float64
+
+	usm       *usmKeys
+	salt      atomic.Uint64
+	requestID atomic.Uint32
 }
 
 type ProtocolOption func(p *protocol) error
@@ -31,7 +41,10 @@ func NewProtocol(options ...ProtocolOption) (Protocol, error) {
 		version:        -1,
 		bufferSize:     4096,
 		receiveTimeout: 2 * time.Second,
+		retries:        2,
+		backoff:        1.5,
 	}
+	p.requestID.Store(mathrand.Uint32())
 	for _, option := range options {
 		err := option(p)
 		if err != nil {
@@ -44,45 +57,172 @@ func NewProtocol(options ...ProtocolOption) (Protocol, error) {
 	return p, nil
 }
 
+// Dial opens a dedicated connection to address. A tcp:// prefix selects
+// SNMP over TCP (RFC 3430), which suits agents with responses too large
+// for a datagram.
 func (p *protocol) Dial(address string) (Connection, error) {
-	parts := strings.Split(address, ":")
-	port := 161
-	var err error
-
-	switch len(parts) {
-	case 1:
-		//all good nothing to see here
-	case 2:
-		port, err = strconv.Atoi(parts[1])
+	network, address := splitScheme(address)
+	udpAddr, err := resolveTarget(address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		tcpAddr := &net.TCPAddr{IP: udpAddr.IP, Port: udpAddr.Port, Zone: udpAddr.Zone}
+		conn, err := net.DialTCP(strings.Replace(udpNetwork(udpAddr), "udp", "tcp", 1), nil, tcpAddr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid port: %v", err)
+			return nil, fmt.Errorf("error connecting to %s : %v", tcpAddr, err)
+		}
+		return &connection{protocol: p, transport: &tcpTransport{conn: conn, reader: bufio.NewReader(conn)}}, nil
+	}
+	conn, err := net.DialUDP(udpNetwork(udpAddr), nil, udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s : %v", udpAddr, err)
+	}
+
+	return &connection{protocol: p, transport: &udpTransport{conn: conn, bufferSize: p.bufferSize}}, nil
+}
+
+// splitScheme separates an optional udp:// or tcp:// prefix from address,
+// the default is udp
+func splitScheme(address string) (network, rest string) {
+	for _, network := range []string{"udp", "tcp"} {
+		if rest, ok := strings.CutPrefix(address, network+"://"); ok {
+			return network, rest
 		}
-		address = parts[0]
-	default:
-		//TODO handle IPV6
-		return nil, fmt.Errorf("invalid address: %s", address)
 	}
+	return "udp", address
+}
+
+// udpNetwork picks the socket family for addr
+func udpNetwork(addr *net.UDPAddr) string {
+	if addr.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
 
-	ip, err := net.ResolveIPAddr("ip", address)
+// resolveTarget turns host[:port] into an address, the port defaults to 161.
+// IPv6 literals may be bare, or in brackets to give a port, and link local
+// ones may have a zone, e.g. [fe80::1%eth0]:1161
+func resolveTarget(address string) (*net.UDPAddr, error) {
+	host, port := address, "161"
+	switch {
+	case strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]"):
+		host = address[1 : len(address)-1]
+	case strings.HasPrefix(address, "[") || strings.Count(address, ":") == 1:
+		var err error
+		host, port, err = net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address: %v", err)
+		}
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
 	if err != nil {
-		return nil, fmt.Errorf("error resolving address %s: %v", address, err)
+		return nil, fmt.Errorf("invalid port %q in %s", port, address)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid address: %s has no host", address)
 	}
 
-	udpAddr := net.UDPAddr{
+	//hostnames resolve to IPv4 when they have both, otherwise IPv6
+	ip, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving address %s: %v", host, err)
+	}
+
+	return &net.UDPAddr{
 		IP:   ip.IP,
-		Port: port,
+		Zone: ip.Zone,
+		Port: int(n),
+	}, nil
+}
+
+// peekVersion reads the msgVersion field without decoding the rest of the message
+func peekVersion(frame []byte) (int, error) {
+	var outer, first asn1binary.Value
+	_, err := outer.Unmarshal(frame)
+	if err != nil {
+		return 0, err
 	}
-	conn, err := net.DialUDP("udp", nil, &udpAddr)
+	_, err = first.Unmarshal(outer.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to %s:%d : %v", address, port, err)
+		return 0, err
 	}
+	return valueInt(&first)
+}
 
-	return &connection{protocol: p, conn: conn}, nil
+// peekRequestID returns the id used to correlate a response with its request,
+// the msgID for v3 and the request-id for v1/v2c, without decrypting or
+// decoding the varbinds
+func peekRequestID(frame []byte) (int, error) {
+	var outer, element asn1binary.Value
+	_, err := outer.Unmarshal(frame)
+	if err != nil {
+		return 0, err
+	}
+	tail, err := element.Unmarshal(outer.Bytes)
+	if err != nil {
+		return 0, err
+	}
+	version, err := valueInt(&element)
+	if err != nil {
+		return 0, err
+	}
+	if version != v3 {
+		//skip the community
+		tail, err = element.Unmarshal(tail)
+		if err != nil {
+			return 0, err
+		}
+	}
+	//the v3 header data or the PDU, both start with the id
+	_, err = element.Unmarshal(tail)
+	if err != nil {
+		return 0, err
+	}
+	_, err = element.Unmarshal(element.Bytes)
+	if err != nil {
+		return 0, err
+	}
+	return valueInt(&element)
 }
 
+func valueInt(value *asn1binary.Value) (int, error) {
+	var n asn1go.Integer
+	err := value.UnpackIntoGo(&n)
+	if err != nil {
+		return 0, err
+	}
+	i, err := n.GetInt(32)
+	return int(i), err
+}
+
+// DecodeFrame decodes a message of any version. For v3 messages the
+// Community field holds the USM user name. v1 Trap-PDUs are converted to
+// the v2c notification layout, use DecodeTrapV1 to see the original fields.
 func (p *protocol) DecodeFrame(frame []byte) (*Message, error) {
+	version, err := peekVersion(frame)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SNMP message: %v", err)
+	}
+	if version == v3 {
+		msg, params, pdu, err := p.decodeV3(frame)
+		if err != nil {
+			return nil, err
+		}
+		return &Message{Version: msg.Version, Community: params.UserName, PDU: *pdu}, nil
+	}
+	if version == v1 {
+		tag, err := peekPDUTag(frame)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling SNMP message: %v", err)
+		}
+		if tag == TRAP {
+			return p.decodeTrapV1(frame)
+		}
+	}
 	message := Message{}
-	_, err := asn1binary.Unmarshal(frame, &message)
+	_, err = asn1binary.Unmarshal(frame, &message)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling SNMP message: %v", err)
 	}
@@ -90,6 +230,12 @@ func (p *protocol) DecodeFrame(frame []byte) (*Message, error) {
 }
 
 func (p *protocol) EncodePDU(pType asn1binary.Tag, pdu *PDU) ([]byte, error) {
+	if p.version == v1 && pType == GET_BULK {
+		return nil, fmt.Errorf("GET_BULK is not supported by SNMPv1")
+	}
+	if p.version == v3 {
+		return p.encodeV3(pType, pdu, v3Options{msgID: p.nextRequestID(), flags: reportableFlag(pType)})
+	}
 	msg := Message{
 		Version:   p.version,
 		Community: p.community,
@@ -125,3 +271,33 @@ func WithReceiveTimeout(timeout time.Duration) ProtocolOption {
 		return nil
 	}
 }
+
+// WithRetries sets how many times a request is resent when no response
+// arrives within the receive timeout
+func WithRetries(retries int) ProtocolOption {
+	return func(p *protocol) error {
+		if retries < 0 {
+			return fmt.Errorf("retries must not be negative")
+		}
+		p.retries = retries
+		return nil
+	}
+}
+
+// WithBackoff sets the factor the receive timeout is multiplied by after
+// each unanswered attempt. A factor of 1 keeps the timeout constant.
+func WithBackoff(factor float64) ProtocolOption {
+	return func(p *protocol) error {
+		if factor < 1 {
+			return fmt.Errorf("backoff factor must be at least 1")
+		}
+		p.backoff = factor
+		return nil
+	}
+}
+
+// nextRequestID is shared by all connections of a protocol, it is used as
+// the msgID of v3 messages as well
+func (p *protocol) nextRequestID() int {
+	return int(p.requestID.Add(1) & 0x7FFFFFFF)
+}
@@ -0,0 +1,148 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"10.0.0.1", "10.0.0.1:161"},
+		{"10.0.0.1:1161", "10.0.0.1:1161"},
+		{"::1", "[::1]:161"},
+		{"[::1]", "[::1]:161"},
+		{"[::1]:1161", "[::1]:1161"},
+		{"2001:db8::5", "[2001:db8::5]:161"},
+		{"fe80::1%lo", "[fe80::1%lo]:161"},
+		{"[fe80::1%lo]:162", "[fe80::1%lo]:162"},
+		{"localhost:1161", "127.0.0.1:1161"},
+	}
+	for _, tt := range tests {
+		addr, err := resolveTarget(tt.address)
+		if err != nil {
+			t.Errorf("%s: %v", tt.address, err)
+			continue
+		}
+		if addr.String() != tt.want {
+			t.Errorf("%s resolved to %s, want %s", tt.address, addr, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"[::1", "[::1]:", "10.0.0.1:x", "10.0.0.1:70000", ":161", "[]:161"} {
+		_, err := resolveTarget(invalid)
+		if err == nil {
+			t.Errorf("%s was accepted", invalid)
+		}
+	}
+}
+
+func TestIPv6Agent(t *testing.T) {
+	probe, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	probe.Close()
+
+	snapshot, err := ReadSnapshotText(strings.NewReader(testWalk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := NewAgent(snapshot, WithAgentAddress("[::1]:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	_, port, _ := net.SplitHostPort(agent.Addr())
+
+	p, err := NewProtocol(WithV2("public"), WithReceiveTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dial := func(address string) (Connection, error) { return p.Dial(address) }
+	for name, connect := range map[string]func(string) (Connection, error){"dial": dial, "client": client.Target} {
+		for _, address := range []string{"[::1]:" + port, "ip6-localhost:" + port} {
+			conn, err := connect(address)
+			if err != nil {
+				if strings.HasPrefix(address, "ip6-localhost") {
+					//not every resolver knows the name
+					continue
+				}
+				t.Fatalf("%s %s: %v", name, address, err)
+			}
+			c := &collector{}
+			err = Walk(context.Background(), conn, asn1go.OID{1, 3, 6, 1}, c)
+			conn.Close()
+			if err != nil {
+				t.Errorf("%s %s: %v", name, address, err)
+				continue
+			}
+			if len(c.varBinds) != snapshot.Len() {
+				t.Errorf("%s %s: walked %d varbinds, want %d", name, address, len(c.varBinds), snapshot.Len())
+			}
+		}
+	}
+}
+
+func TestTCPAgent(t *testing.T) {
+	//rows big enough that one bulk response is far larger than a UDP buffer
+	text := &strings.Builder{}
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(text, ".1.3.6.1.4.1.99999.1.%d = STRING: \"%s\"\n", i, strings.Repeat("x", 200))
+	}
+	snapshot, err := ReadSnapshotText(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := NewAgent(snapshot, WithAgentAddress("tcp://127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	if !strings.HasPrefix(agent.Addr(), "tcp://") {
+		t.Fatalf("agent address %s is not tcp", agent.Addr())
+	}
+
+	p, err := NewProtocol(WithV2("public"), WithReceiveTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := p.Dial(agent.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, repetitions := range []int{1, 250} {
+		c := &collector{}
+		err = Walk(context.Background(), conn, asn1go.OID{1, 3, 6, 1}, c, WithMaxRepetitions(repetitions))
+		if err != nil {
+			t.Fatalf("%d repetitions: %v", repetitions, err)
+		}
+		if len(c.varBinds) != snapshot.Len() {
+			t.Errorf("%d repetitions: walked %d varbinds, want %d", repetitions, len(c.varBinds), snapshot.Len())
+		}
+	}
+
+	client, err := NewClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Target(agent.Addr()); err == nil {
+		t.Error("client accepted a tcp target")
+	}
+}
@@ -0,0 +1,109 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lossyAgent ignores the first request it sees, then answers each request
+// with a stale response followed by a duplicated correct one
+func lossyAgent(t *testing.T) (string, *atomic.Int32) {
+	p, err := NewProtocol(WithV2("public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	seen := new(atomic.Int32)
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if seen.Add(1) == 1 {
+				continue
+			}
+			message, err := p.DecodeFrame(buffer[:n])
+			if err != nil {
+				t.Log(err)
+				continue
+			}
+			for _, id := range []int{message.PDU.RequestID - 1, message.PDU.RequestID, message.PDU.RequestID} {
+				reply := &PDU{RequestID: id, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}}
+				frame, err := p.EncodePDU(RESPONSE, reply)
+				if err != nil {
+					t.Log(err)
+					continue
+				}
+				conn.WriteToUDP(frame, from)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), seen
+}
+
+func TestRequestRetry(t *testing.T) {
+	address, seen := lossyAgent(t)
+	p, err := NewProtocol(WithV2("public"), WithReceiveTimeout(100*time.Millisecond), WithRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := p.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		request := &PDU{VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}}
+		response, err := conn.Request(context.Background(), GET, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.RequestID != request.RequestID {
+			t.Errorf("got request id %d, want %d", response.RequestID, request.RequestID)
+		}
+	}
+	if seen.Load() != 3 {
+		t.Errorf("agent saw %d requests, want 3", seen.Load())
+	}
+}
+
+func TestRequestCancel(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p, err := NewProtocol(WithV2("public"), WithReceiveTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := p.Dial(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.Request(ctx, GET, &PDU{VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("request was not cancelled promptly")
+	}
+}
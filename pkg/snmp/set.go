@@ -0,0 +1,160 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// syntaxEnvelopes maps the SMI base types to the envelope of their values
+var syntaxEnvelopes = map[string]asn1binary.Envelope{
+	"INTEGER":           {Class: asn1binary.ClassUniversal, Tag: asn1binary.TagInteger},
+	"Integer32":         {Class: asn1binary.ClassUniversal, Tag: asn1binary.TagInteger},
+	"OCTET STRING":      {Class: asn1binary.ClassUniversal, Tag: asn1binary.TagOctetString},
+	"BITS":              {Class: asn1binary.ClassUniversal, Tag: asn1binary.TagOctetString},
+	"OBJECT IDENTIFIER": {Class: asn1binary.ClassUniversal, Tag: asn1binary.TagOID},
+	"IpAddress":         {Class: asn1binary.ClassApplication, Tag: TagIpAddress},
+	"NetworkAddress":    {Class: asn1binary.ClassApplication, Tag: TagIpAddress},
+	"Counter":           {Class: asn1binary.ClassApplication, Tag: TagCounter32},
+	"Counter32":         {Class: asn1binary.ClassApplication, Tag: TagCounter32},
+	"Gauge":             {Class: asn1binary.ClassApplication, Tag: TagGauge32},
+	"Gauge32":           {Class: asn1binary.ClassApplication, Tag: TagGauge32},
+	"Unsigned32":        {Class: asn1binary.ClassApplication, Tag: TagGauge32},
+	"TimeTicks":         {Class: asn1binary.ClassApplication, Tag: TagTimeTicks},
+	"Opaque":            {Class: asn1binary.ClassApplication, Tag: TagOpaque},
+	"Counter64":         {Class: asn1binary.ClassApplication, Tag: TagCounter64},
+}
+
+var writableAccess = []string{"read-write", "read-create", "write-only"}
+
+// syntax is an object's SYNTAX resolved through any textual conventions.
+// Every constraint met on the way applies, so all must be satisfied.
+type syntax struct {
+	base   string
+	ranges [][]mibdb.Range
+	sizes  [][]mibdb.Range
+	enums  map[int]string
+}
+
+func resolveSyntax(db *mibdb.Database, object *mibdb.Object) *syntax {
+	s := &syntax{}
+	current := object.Get("SYNTAX")
+	for depth := 0; current != nil && depth < 32; depth++ {
+		switch value := current.(type) {
+		case *mibdb.TypeReference:
+			ranges, size := value.CompileRanges()
+			if size {
+				s.sizes = append(s.sizes, ranges)
+			} else if ranges != nil {
+				s.ranges = append(s.ranges, ranges)
+			}
+			if s.enums == nil {
+				s.enums = value.CompileEnums()
+			}
+			if _, ok := syntaxEnvelopes[value.Name()]; ok {
+				s.base = value.Name()
+				return s
+			}
+			current = db.LookupName(value.Name())
+		case *mibdb.CompositeValue:
+			//textual convention
+			current = value.Get("SYNTAX")
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+func inRanges(n int64, ranges []mibdb.Range) bool {
+	return slices.ContainsFunc(ranges, func(r mibdb.Range) bool {
+		return n >= r.Min && n <= r.Max
+	})
+}
+
+func stashString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) == 1 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// ValidateSet checks that vb names an instance of a writable object in db
+// and that its value has the type and respects the constraints of the
+// object's SYNTAX
+func ValidateSet(db *mibdb.Database, vb *VarBind) error {
+	branch, tail := db.FindOID(vb.OID)
+	if branch == nil || branch.Object() == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownObject, vb.OID)
+	}
+	object := branch.Object()
+	access := stashString(object.Get("MAX-ACCESS"))
+	if access == "" || len(tail) == 0 {
+		return fmt.Errorf("%w: %s is not an object instance", ErrUnknownObject, OIDName(db, vb.OID))
+	}
+	if !slices.Contains(writableAccess, access) {
+		return fmt.Errorf("%w: %s is %s", ErrNotWritable, object.Name(), access)
+	}
+
+	s := resolveSyntax(db, object)
+	envelope, ok := syntaxEnvelopes[s.base]
+	if !ok {
+		//unknown syntax, let the agent decide
+		return nil
+	}
+	if vb.Value.Class != envelope.Class || vb.Value.Tag != envelope.Tag {
+		return fmt.Errorf("%w: %s needs %s", ErrWrongType, object.Name(), s.base)
+	}
+	switch s.base {
+	case "INTEGER", "Integer32", "Counter", "Counter32", "Gauge", "Gauge32", "Unsigned32", "TimeTicks":
+		i := asn1go.Integer(vb.Value.Bytes)
+		n, err := i.GetInt(64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrWrongValue, object.Name(), err)
+		}
+		for _, ranges := range s.ranges {
+			if !inRanges(n, ranges) {
+				return fmt.Errorf("%w: %d is out of range for %s", ErrWrongValue, n, object.Name())
+			}
+		}
+		if s.enums != nil {
+			if _, ok := s.enums[int(n)]; !ok {
+				return fmt.Errorf("%w: %d is not an enumeration of %s", ErrWrongValue, n, object.Name())
+			}
+		}
+	case "OCTET STRING", "BITS", "Opaque":
+		for _, sizes := range s.sizes {
+			if !inRanges(int64(len(vb.Value.Bytes)), sizes) {
+				return fmt.Errorf("%w: length %d is out of range for %s", ErrWrongLength, len(vb.Value.Bytes), object.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// Set sends varBinds in a SET request. Unless db is nil each varbind is first
+// checked with ValidateSet so nothing is sent if any would be rejected.
+func Set(ctx context.Context, conn Connection, db *mibdb.Database, varBinds ...VarBind) (*PDU, error) {
+	if db != nil {
+		for i := range varBinds {
+			err := ValidateSet(db, &varBinds[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	response, err := conn.Request(ctx, SET, &PDU{VarBinds: varBinds})
+	if err != nil {
+		return nil, err
+	}
+	return response, CheckPDU(response)
+}
@@ -0,0 +1,134 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+const setTestMib = `SET-TEST-MIB DEFINITIONS ::= BEGIN
+
+ObjectName ::= OBJECT IDENTIFIER
+
+DisplayString ::= OCTET STRING (SIZE (0..255))
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testName OBJECT-TYPE
+    SYNTAX DisplayString (SIZE (0..8))
+    ACCESS read-write
+    STATUS mandatory
+    DESCRIPTION "a name"
+    ::= { test 1 }
+
+testLevel OBJECT-TYPE
+    SYNTAX INTEGER (-5..10 | 20)
+    ACCESS read-write
+    STATUS mandatory
+    DESCRIPTION "a level"
+    ::= { test 2 }
+
+testStatus OBJECT-TYPE
+    SYNTAX INTEGER { up(1), down(2) }
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "a status"
+    ::= { test 3 }
+
+testAdmin OBJECT-TYPE
+    SYNTAX INTEGER { up(1), down(2) }
+    ACCESS read-write
+    STATUS mandatory
+    DESCRIPTION "an admin status"
+    ::= { test 4 }
+
+END
+`
+
+// loadTestMib compiles a single module given as text
+func loadTestMib(t *testing.T, name, text string) *mibdb.Database {
+	filename := filepath.Join(t.TempDir(), name+".mib")
+	err := os.WriteFile(filename, []byte(text), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := mibdb.New(slog.Default())
+	err = db.AddFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestValidateSet(t *testing.T) {
+	db := loadTestMib(t, "SET-TEST-MIB", setTestMib)
+	test := asn1go.OID{1, 3, 6, 1, 4, 1, 99999}
+	instance := func(n int) asn1go.OID {
+		return append(append(asn1go.OID{}, test...), n, 0)
+	}
+
+	tests := []struct {
+		name  string
+		oid   asn1go.OID
+		value asn1binary.Value
+		err   error
+	}{
+		{"string", instance(1), NewOctetString([]byte("switch")), nil},
+		{"string too long for object", instance(1), NewOctetString([]byte("switch-01")), ErrWrongLength},
+		{"string for integer", instance(2), NewOctetString([]byte("1")), ErrWrongType},
+		{"integer low", instance(2), NewInteger32(-5), nil},
+		{"integer single value", instance(2), NewInteger32(20), nil},
+		{"integer between ranges", instance(2), NewInteger32(15), ErrWrongValue},
+		{"gauge for integer", instance(2), NewGauge32(1), ErrWrongType},
+		{"read only", instance(3), NewInteger32(1), ErrNotWritable},
+		{"enumeration", instance(4), NewInteger32(2), nil},
+		{"not an enumeration", instance(4), NewInteger32(3), ErrWrongValue},
+		{"object not instance", test, NewInteger32(1), ErrUnknownObject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSet(db, &VarBind{OID: tt.oid, Value: tt.value})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSetSent(t *testing.T) {
+	db := loadTestMib(t, "SET-TEST-MIB", setTestMib)
+	agent, err := NewAgent(NewSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	p, _ := NewProtocol(WithV2("public"))
+	conn, err := p.Dial(agent.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	vb := VarBind{OID: asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 2, 0}, Value: NewInteger32(3)}
+	_, err = Set(context.Background(), conn, db, vb)
+	//the simulator is read only so a valid SET reaches it and is refused
+	if !IsErrorStatus(err, NotWritable) {
+		t.Errorf("got %v, want notWritable", err)
+	}
+	vb.Value = NewInteger32(11)
+	_, err = Set(context.Background(), conn, db, vb)
+	if !errors.Is(err, ErrWrongValue) {
+		t.Errorf("got %v, want %v", err, ErrWrongValue)
+	}
+}
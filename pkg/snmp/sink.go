@@ -0,0 +1,278 @@
+package snmp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/maps"
+)
+
+type MetricType string
+
+const (
+	MetricUntyped MetricType = ""
+	MetricGauge   MetricType = "gauge"
+	MetricCounter MetricType = "counter"
+)
+
+// Sample is one value of a metric family. Labels may be shared between
+// samples and must not be modified.
+type Sample struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time // zero when the sample has none
+}
+
+// MetricFamily is a metric decoded from SNMP varbinds with all its samples
+type MetricFamily struct {
+	Name       string
+	Help       string
+	Type       MetricType
+	LabelNames []string // the order to write labels in
+	Samples    []Sample
+}
+
+// labelNames returns the names of labels in order, including any of sample's
+// that the family does not list
+func (family *MetricFamily) labelNames(sample *Sample) []string {
+	names := family.LabelNames
+	if len(names) == len(sample.Labels) {
+		return names
+	}
+	names = slices.Clone(names)
+	extra := maps.Keys(sample.Labels)
+	slices.Sort(extra)
+	for _, name := range extra {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MetricSink receives the metric families produced by a MetricPrinter
+type MetricSink interface {
+	WriteFamily(ctx context.Context, family *MetricFamily) error
+	// Flush is called once all families have been written
+	Flush(ctx context.Context) error
+}
+
+// ------------------------------------
+
+// TextSink writes the prometheus text exposition format, or OpenMetrics
+type TextSink struct {
+	w           io.Writer
+	openMetrics bool
+}
+
+var _ MetricSink = &TextSink{}
+
+func NewPrometheusSink(w io.Writer) *TextSink {
+	return &TextSink{w: w}
+}
+
+func NewOpenMetricsSink(w io.Writer) *TextSink {
+	return &TextSink{w: w, openMetrics: true}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatSampleValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (sink *TextSink) WriteFamily(ctx context.Context, family *MetricFamily) error {
+	name := family.Name
+	metricType := string(family.Type)
+	help := helpEscaper.Replace(family.Help)
+	if sink.openMetrics {
+		//counter families are named without the suffix their samples have
+		if family.Type == MetricCounter {
+			name = strings.TrimSuffix(name, "_total")
+		}
+		if metricType == "" {
+			metricType = "unknown"
+		}
+		help = strings.ReplaceAll(help, `"`, `\"`)
+	}
+
+	sb := &strings.Builder{}
+	if family.Help != "" {
+		fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	}
+	if metricType != "" {
+		fmt.Fprintf(sb, "# TYPE %s %s\n", name, metricType)
+	}
+	for i := range family.Samples {
+		sample := &family.Samples[i]
+		sb.WriteString(family.Name)
+		if len(sample.Labels) > 0 {
+			sb.WriteByte('{')
+			for j, label := range family.labelNames(sample) {
+				if j > 0 {
+					sb.WriteByte(',')
+				}
+				fmt.Fprintf(sb, `%s="%s"`, label, labelEscaper.Replace(sample.Labels[label]))
+			}
+			sb.WriteByte('}')
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(formatSampleValue(sample.Value))
+		if !sample.Timestamp.IsZero() {
+			if sink.openMetrics {
+				fmt.Fprintf(sb, " %.3f", float64(sample.Timestamp.UnixMilli())/1000)
+			} else {
+				fmt.Fprintf(sb, " %d", sample.Timestamp.UnixMilli())
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	_, err := io.WriteString(sink.w, sb.String())
+	return err
+}
+
+func (sink *TextSink) Flush(ctx context.Context) error {
+	if sink.openMetrics {
+		_, err := io.WriteString(sink.w, "# EOF\n")
+		return err
+	}
+	return nil
+}
+
+// ------------------------------------
+
+// JSONLinesSink writes each sample as a JSON object on its own line
+type JSONLinesSink struct {
+	encoder *json.Encoder
+}
+
+var _ MetricSink = &JSONLinesSink{}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{encoder: json.NewEncoder(w)}
+}
+
+type jsonSample struct {
+	Name      string            `json:"name"`
+	Type      MetricType        `json:"type,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     float64           `json:"value"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+}
+
+func (sink *JSONLinesSink) WriteFamily(ctx context.Context, family *MetricFamily) error {
+	for _, sample := range family.Samples {
+		line := jsonSample{
+			Name:   family.Name,
+			Type:   family.Type,
+			Labels: sample.Labels,
+			Value:  sample.Value,
+		}
+		if !sample.Timestamp.IsZero() {
+			line.Timestamp = &sample.Timestamp
+		}
+		err := sink.encoder.Encode(&line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *JSONLinesSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// ------------------------------------
+
+// Collector is a MetricSink that can be registered with a prometheus
+// registry. It serves the families written before the latest Flush, so a walk
+// in progress is never half exposed.
+type Collector struct {
+	lock     sync.Mutex
+	pending  []*MetricFamily
+	families []*MetricFamily
+}
+
+var _ MetricSink = &Collector{}
+var _ prometheus.Collector = &Collector{}
+
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+func (c *Collector) WriteFamily(ctx context.Context, family *MetricFamily) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending = append(c.pending, family)
+	return nil
+}
+
+func (c *Collector) Flush(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.families = c.pending
+	c.pending = nil
+	return nil
+}
+
+// Describe sends nothing as the metrics depend on what the agent returns,
+// making this an unchecked collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	families := c.families
+	c.lock.Unlock()
+
+	for _, family := range families {
+		valueType := prometheus.UntypedValue
+		switch family.Type {
+		case MetricCounter:
+			valueType = prometheus.CounterValue
+		case MetricGauge:
+			valueType = prometheus.GaugeValue
+		}
+		for i := range family.Samples {
+			sample := &family.Samples[i]
+			names := family.labelNames(sample)
+			values := make([]string, len(names))
+			for j, name := range names {
+				values[j] = sample.Labels[name]
+			}
+			desc := prometheus.NewDesc(family.Name, family.Help, names, nil)
+			metric, err := prometheus.NewConstMetric(desc, valueType, sample.Value, values...)
+			if err != nil {
+				ch <- prometheus.NewInvalidMetric(desc, err)
+				continue
+			}
+			if !sample.Timestamp.IsZero() {
+				metric = prometheus.NewMetricWithTimestamp(sample.Timestamp, metric)
+			}
+			ch <- metric
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func testFamilies() []*MetricFamily {
+	labels := map[string]string{"name": `eth"0`, "addr": "10.0.0.1"}
+	return []*MetricFamily{
+		{
+			Name:       "if_in_octets_total",
+			Help:       "octets in",
+			Type:       MetricCounter,
+			LabelNames: []string{"name", "addr"},
+			Samples:    []Sample{{Labels: labels, Value: 1234}},
+		},
+		{
+			Name:    "sys_up_time",
+			Samples: []Sample{{Value: 0.5, Timestamp: time.UnixMilli(1700000000123)}},
+		},
+	}
+}
+
+func TestSinks(t *testing.T) {
+	tests := []struct {
+		name string
+		sink func(buffer *bytes.Buffer) MetricSink
+		want string
+	}{
+		{"prometheus", func(b *bytes.Buffer) MetricSink { return NewPrometheusSink(b) }, `# HELP if_in_octets_total octets in
+# TYPE if_in_octets_total counter
+if_in_octets_total{name="eth\"0",addr="10.0.0.1"} 1234
+sys_up_time 0.5 1700000000123
+`},
+		{"openmetrics", func(b *bytes.Buffer) MetricSink { return NewOpenMetricsSink(b) }, `# HELP if_in_octets octets in
+# TYPE if_in_octets counter
+if_in_octets_total{name="eth\"0",addr="10.0.0.1"} 1234
+# TYPE sys_up_time unknown
+sys_up_time 0.5 1700000000.123
+# EOF
+`},
+		{"json lines", func(b *bytes.Buffer) MetricSink { return NewJSONLinesSink(b) }, `{"name":"if_in_octets_total","type":"counter","labels":{"addr":"10.0.0.1","name":"eth\"0"},"value":1234}
+{"name":"sys_up_time","value":0.5,"timestamp":"` + time.UnixMilli(1700000000123).Format(time.RFC3339Nano) + `"}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			sink := tt.sink(buffer)
+			for _, family := range testFamilies() {
+				err := sink.WriteFamily(context.Background(), family)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := sink.Flush(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buffer.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buffer.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+	for _, family := range testFamilies() {
+		err := collector.WriteFamily(context.Background(), family)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	gathered, err := registry.Gather()
+	if err != nil || len(gathered) != 0 {
+		t.Fatalf("gathered %d families before Flush: %v", len(gathered), err)
+	}
+	err = collector.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered, err = registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gathered) != 2 {
+		t.Fatalf("gathered %d families, want 2", len(gathered))
+	}
+	octets := gathered[0]
+	if octets.GetName() != "if_in_octets_total" || octets.GetHelp() != "octets in" {
+		t.Errorf("got family %s %q", octets.GetName(), octets.GetHelp())
+	}
+	metric := octets.GetMetric()[0]
+	labels := map[string]string{}
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	if labels["name"] != `eth"0` || labels["addr"] != "10.0.0.1" || metric.GetCounter().GetValue() != 1234 {
+		t.Errorf("got %v %v", labels, metric)
+	}
+	if gathered[1].GetMetric()[0].GetTimestampMs() != 1700000000123 {
+		t.Errorf("timestamp was not kept: %v", gathered[1])
+	}
+}
@@ -0,0 +1,272 @@
+package snmp
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+// Snapshot is an ordered set of varbinds, typically recorded from a real
+// device, that an Agent serves. It must not be modified while being served.
+type Snapshot struct {
+	varBinds []VarBind
+}
+
+func NewSnapshot(varBinds ...VarBind) *Snapshot {
+	s := &Snapshot{}
+	for _, vb := range varBinds {
+		s.Add(vb)
+	}
+	return s
+}
+
+func compareOID(a, b asn1go.OID) int {
+	if a.Equal(b) {
+		return 0
+	}
+	if a.LessThan(b) {
+		return -1
+	}
+	return 1
+}
+
+// Add inserts or replaces the varbind with the same OID
+func (s *Snapshot) Add(vb VarBind) {
+	i, found := slices.BinarySearchFunc(s.varBinds, vb.OID, func(e VarBind, oid asn1go.OID) int {
+		return compareOID(e.OID, oid)
+	})
+	if found {
+		s.varBinds[i] = vb
+		return
+	}
+	s.varBinds = slices.Insert(s.varBinds, i, vb)
+}
+
+// AddResponse records the varbinds of a RESPONSE, skipping exception values,
+// so a snapshot can be built from captured traffic
+func (s *Snapshot) AddResponse(pdu *PDU) {
+	if pdu.Tag != RESPONSE || pdu.ErrorStatus != 0 {
+		return
+	}
+	for _, vb := range pdu.VarBinds {
+		if !vb.IsException() {
+			s.Add(vb)
+		}
+	}
+}
+
+func (s *Snapshot) Len() int {
+	return len(s.varBinds)
+}
+
+func (s *Snapshot) Get(oid asn1go.OID) (VarBind, bool) {
+	i, found := slices.BinarySearchFunc(s.varBinds, oid, func(e VarBind, oid asn1go.OID) int {
+		return compareOID(e.OID, oid)
+	})
+	if !found {
+		return VarBind{}, false
+	}
+	return s.varBinds[i], true
+}
+
+// Next returns the first varbind after oid in lexicographic order
+func (s *Snapshot) Next(oid asn1go.OID) (VarBind, bool) {
+	i, found := slices.BinarySearchFunc(s.varBinds, oid, func(e VarBind, oid asn1go.OID) int {
+		return compareOID(e.OID, oid)
+	})
+	if found {
+		i++
+	}
+	if i >= len(s.varBinds) {
+		return VarBind{}, false
+	}
+	return s.varBinds[i], true
+}
+
+// ReadSnapshotText reads the output of `snmpwalk -On`, one varbind per line
+// in the form ".1.3.6.1.2.1.1.1.0 = STRING: "text"". Quoted strings may
+// span several lines.
+func ReadSnapshotText(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(line, " = ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"oid = type: value\"", lineNumber)
+		}
+		typeName, value, ok := strings.Cut(rest, ": ")
+		if !ok {
+			typeName, value = strings.TrimSuffix(rest, ":"), ""
+		}
+		if rest == `""` {
+			typeName, value = "STRING", `""`
+		}
+		//continue quoted strings that contain new lines
+		for strings.HasPrefix(value, `"`) && (len(value) == 1 || !strings.HasSuffix(value, `"`)) && scanner.Scan() {
+			lineNumber++
+			value += "\n" + scanner.Text()
+		}
+		if strings.HasPrefix(typeName, "No Such") || strings.HasPrefix(typeName, "No more") {
+			continue
+		}
+		vb, err := parseSnapshotVarBind(name, typeName, value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		s.Add(vb)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type snapshotJSONEntry struct {
+	OID   string `json:"oid"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ReadSnapshotJSON reads a list of {"oid", "type", "value"} objects where
+// type and value use the same spelling as snmpwalk output
+func ReadSnapshotJSON(r io.Reader) (*Snapshot, error) {
+	var entries []snapshotJSONEntry
+	err := json.NewDecoder(r).Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	for i, entry := range entries {
+		vb, err := parseSnapshotVarBind(entry.OID, entry.Type, entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i, err)
+		}
+		s.Add(vb)
+	}
+	return s, nil
+}
+
+func parseNumericOID(s string) (asn1go.OID, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "::") {
+		return nil, fmt.Errorf("symbolic oid %q, record walks with -On", s)
+	}
+	return asn1go.ParseOID(strings.TrimPrefix(s, "."), nil)
+}
+
+func parseSnapshotVarBind(name, typeName, value string) (VarBind, error) {
+	oid, err := parseNumericOID(name)
+	if err != nil {
+		return VarBind{}, err
+	}
+	vb := VarBind{OID: oid}
+	vb.Value, err = parseSnapshotValue(strings.TrimSpace(typeName), strings.TrimSpace(value))
+	if err != nil {
+		return VarBind{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return vb, nil
+}
+
+func parseSnapshotValue(typeName, value string) (asn1binary.Value, error) {
+	switch typeName {
+	case "STRING":
+		//net-snmp only escapes quotes and backslashes, and strings may contain new lines
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+		}
+		return NewOctetString([]byte(value)), nil
+	case "Hex-STRING", "BITS":
+		fields := strings.Fields(value)
+		if typeName == "BITS" {
+			//BITS values are followed by the names of the set bits
+			fields = slices.DeleteFunc(fields, func(f string) bool { return len(f) != 2 })
+		}
+		b, err := hex.DecodeString(strings.Join(fields, ""))
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		return NewOctetString(b), nil
+	case "OID":
+		oid, err := parseNumericOID(value)
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		return NewOID(oid)
+	case "INTEGER":
+		//enumerations are shown as name(number)
+		if open := strings.LastIndex(value, "("); open >= 0 && strings.HasSuffix(value, ")") {
+			value = value[open+1 : len(value)-1]
+		}
+		n, err := strconv.ParseInt(strings.Fields(value + " ")[0], 10, 32)
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		return NewInteger32(int32(n)), nil
+	case "Counter64":
+		n, err := strconv.ParseUint(strings.Fields(value + " ")[0], 10, 64)
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		return NewCounter64(n), nil
+	case "Counter32", "Gauge32", "Timeticks", "UInteger32":
+		if typeName == "Timeticks" {
+			//Timeticks: (12345) 0:02:03.45
+			value = strings.TrimPrefix(strings.Fields(value + " ")[0], "(")
+			value = strings.TrimSuffix(value, ")")
+		}
+		n, err := strconv.ParseUint(strings.Fields(value + " ")[0], 10, 32)
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		switch typeName {
+		case "Counter32":
+			return NewCounter32(uint32(n)), nil
+		case "Timeticks":
+			return NewTimeTicks(uint32(n)), nil
+		}
+		return NewGauge32(uint32(n)), nil
+	case "IpAddress", "Network Address":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return asn1binary.Value{}, fmt.Errorf("invalid ip address %q", value)
+		}
+		return NewIpAddress(ip)
+	case "NULL", "Null":
+		return NewNull(), nil
+	case "Opaque":
+		//net-snmp shows the floats it wraps as Opaque: Float: 1.500000
+		kind, number, ok := strings.Cut(value, ":")
+		if ok && (kind == "Float" || kind == "Double") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil {
+				return asn1binary.Value{}, err
+			}
+			if kind == "Float" {
+				return NewOpaqueFloat(float32(f)), nil
+			}
+			return NewOpaqueDouble(f), nil
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return asn1binary.Value{}, err
+		}
+		return NewOpaque(b), nil
+	}
+	return asn1binary.Value{}, fmt.Errorf("unsupported type %q", typeName)
+}
@@ -0,0 +1,139 @@
+package snmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+)
+
+// anyID is passed to transport.read when the caller is not waiting for a
+// particular request
+const anyID = -1
+
+// transport moves frames between a connection and one agent. Shared
+// transports use the ids registered with expect to route responses, a
+// dedicated socket ignores them.
+type transport interface {
+	expect(ctx context.Context, id int) error
+	release(id int)
+	write(ctx context.Context, frame []byte) error
+	read(ctx context.Context, id int, deadline time.Time) ([]byte, error)
+	close() error
+}
+
+// udpTransport is a connected socket owned by a single connection
+type udpTransport struct {
+	conn       *net.UDPConn
+	bufferSize int
+}
+
+func (t *udpTransport) expect(ctx context.Context, id int) error {
+	return nil
+}
+
+func (t *udpTransport) release(id int) {
+}
+
+func (t *udpTransport) write(ctx context.Context, frame []byte) error {
+	_, err := t.conn.Write(frame)
+	if err != nil {
+		return fmt.Errorf("error sending SNMP message: %v", err)
+	}
+	return nil
+}
+
+func (t *udpTransport) read(ctx context.Context, id int, deadline time.Time) ([]byte, error) {
+	conn := t.conn
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buffer := make([]byte, t.bufferSize) //TODO: use a buffer pool
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("error reading SNMP message: %w", err)
+	}
+	return buffer[:n], nil
+}
+
+func (t *udpTransport) close() error {
+	return t.conn.Close()
+}
+
+// tcpTransport carries messages over a stream as described in RFC 3430.
+// Each message is a single BER value so its length is all the framing
+// needed, and there is no size limit as there is for datagrams.
+type tcpTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	broken error
+}
+
+func (t *tcpTransport) expect(ctx context.Context, id int) error {
+	return t.broken
+}
+
+func (t *tcpTransport) release(id int) {
+}
+
+func (t *tcpTransport) write(ctx context.Context, frame []byte) error {
+	if t.broken != nil {
+		return t.broken
+	}
+	deadline, _ := ctx.Deadline()
+	t.conn.SetWriteDeadline(deadline)
+	_, err := t.conn.Write(frame)
+	if err != nil {
+		t.broken = fmt.Errorf("error sending SNMP message: %v", err)
+		return t.broken
+	}
+	return nil
+}
+
+func (t *tcpTransport) read(ctx context.Context, id int, deadline time.Time) ([]byte, error) {
+	if t.broken != nil {
+		return nil, t.broken
+	}
+	conn := t.conn
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	//wait for the start of a message so a timeout here leaves the stream intact
+	_, err := t.reader.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("error reading SNMP message: %w", err)
+	}
+	frame, err := readFrame(t.reader)
+	if err != nil {
+		//part of a message has been consumed so the stream can not be resynchronised
+		t.broken = fmt.Errorf("error reading SNMP message: %w", err)
+		return nil, t.broken
+	}
+	return frame, nil
+}
+
+// readFrame reads the next message from a stream
+func readFrame(r io.Reader) ([]byte, error) {
+	frame := &bytes.Buffer{}
+	var value asn1binary.Value
+	_, err := value.ReadFrom(io.TeeReader(r, frame))
+	if err != nil {
+		return nil, err
+	}
+	return frame.Bytes(), nil
+}
+
+func (t *tcpTransport) close() error {
+	return t.conn.Close()
+}
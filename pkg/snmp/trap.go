@@ -0,0 +1,276 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
+)
+
+// Notification is a trap or inform as passed to a NotificationHandler. v1
+// traps are converted to the v2 layout (RFC 3584) so TrapOID is always set.
+type Notification struct {
+	Source    net.Addr
+	Version   int
+	Community string
+	Inform    bool
+	Received  time.Time
+	UpTime    int64 // hundredths of a second
+	TrapOID   asn1go.OID
+	VarBinds  []VarBind // excluding sysUpTime.0 and snmpTrapOID.0
+
+	requestID int
+	varBinds  []VarBind
+}
+
+type NotificationHandler interface {
+	HandleNotification(ctx context.Context, n *Notification) error
+}
+
+type NotificationHandlerFunc func(ctx context.Context, n *Notification) error
+
+func (f NotificationHandlerFunc) HandleNotification(ctx context.Context, n *Notification) error {
+	return f(ctx, n)
+}
+
+// TrapReceiver listens for v1/v2c traps and informs, acknowledging informs
+// before passing each notification to the handlers in turn
+type TrapReceiver struct {
+	address     string
+	communities []string
+	handlers    []NotificationHandler
+	logger      *slog.Logger
+	bufferSize  int
+}
+
+type TrapReceiverOption func(r *TrapReceiver) error
+
+// WithTrapAddress sets the address ListenAndServe binds, the default is ":162"
+func WithTrapAddress(address string) TrapReceiverOption {
+	return func(r *TrapReceiver) error {
+		r.address = address
+		return nil
+	}
+}
+
+// WithTrapCommunities restricts the communities accepted, by default any
+// community is accepted
+func WithTrapCommunities(communities ...string) TrapReceiverOption {
+	return func(r *TrapReceiver) error {
+		r.communities = append(r.communities, communities...)
+		return nil
+	}
+}
+
+func WithNotificationHandler(handlers ...NotificationHandler) TrapReceiverOption {
+	return func(r *TrapReceiver) error {
+		r.handlers = append(r.handlers, handlers...)
+		return nil
+	}
+}
+
+func WithTrapLogger(logger *slog.Logger) TrapReceiverOption {
+	return func(r *TrapReceiver) error {
+		r.logger = logger
+		return nil
+	}
+}
+
+func NewTrapReceiver(options ...TrapReceiverOption) (*TrapReceiver, error) {
+	r := &TrapReceiver{
+		address:    ":162",
+		logger:     slog.Default(),
+		bufferSize: 65535,
+	}
+	for _, option := range options {
+		err := option(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(r.handlers) == 0 {
+		return nil, fmt.Errorf("at least one notification handler is required")
+	}
+	return r, nil
+}
+
+// ListenAndServe binds the configured address and serves until ctx is done
+func (r *TrapReceiver) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", r.address)
+	if err != nil {
+		return fmt.Errorf("error listening for traps on %s: %v", r.address, err)
+	}
+	return r.Serve(ctx, conn)
+}
+
+// Serve reads notifications from conn until ctx is done, closing conn on return
+func (r *TrapReceiver) Serve(ctx context.Context, conn net.PacketConn) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	buffer := make([]byte, r.bufferSize)
+	for {
+		n, from, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			continue
+		}
+		notification, err := r.decode(buffer[:n], from)
+		if err != nil {
+			r.logger.WarnContext(ctx, "Dropped notification", slog.String("source", from.String()), slog.Any("error", err))
+			continue
+		}
+		if notification == nil {
+			continue
+		}
+		if notification.Inform {
+			err = r.acknowledge(conn, from, notification)
+			if err != nil {
+				r.logger.WarnContext(ctx, "Failed to acknowledge inform", slog.String("source", from.String()), slog.Any("error", err))
+			}
+		}
+		for _, handler := range r.handlers {
+			err = handler.HandleNotification(ctx, notification)
+			if err != nil {
+				r.logger.WarnContext(ctx, "Notification handler failed", slog.String("source", from.String()), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// decode returns nil without an error for PDUs that are not notifications
+func (r *TrapReceiver) decode(frame []byte, from net.Addr) (*Notification, error) {
+	version, err := peekVersion(frame)
+	if err != nil {
+		return nil, err
+	}
+	if version != v1 && version != v2c {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+	var p protocol
+	message, err := p.DecodeFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.communities) > 0 && !slices.Contains(r.communities, message.Community) {
+		return nil, fmt.Errorf("unknown community %q", message.Community)
+	}
+
+	pdu := &message.PDU
+	switch pdu.Tag {
+	case TRAP_V2, INFORM:
+	default:
+		return nil, nil
+	}
+
+	if len(pdu.VarBinds) < 2 || !pdu.VarBinds[0].OID.Equal(sysUpTimeOID) || !pdu.VarBinds[1].OID.Equal(snmpTrapOID) {
+		return nil, fmt.Errorf("notification does not start with sysUpTime.0 and snmpTrapOID.0")
+	}
+	//TimeTicks is an application tagged INTEGER
+	var upTime asn1go.Integer
+	err = upTime.UnpackAsn1(asn1binary.Envelope{Tag: asn1binary.TagInteger}, pdu.VarBinds[0].Value.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sysUpTime: %v", err)
+	}
+	var trapOID asn1go.OID
+	err = pdu.VarBinds[1].Value.UnpackIntoGo(&trapOID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snmpTrapOID: %v", err)
+	}
+	n := &Notification{
+		Source:    from,
+		Version:   message.Version,
+		Community: message.Community,
+		Inform:    pdu.Tag == INFORM,
+		Received:  time.Now(),
+		TrapOID:   trapOID,
+		VarBinds:  pdu.VarBinds[2:],
+		requestID: pdu.RequestID,
+		varBinds:  pdu.VarBinds,
+	}
+	n.UpTime, _ = upTime.GetInt(64)
+	return n, nil
+}
+
+// acknowledge answers an inform with a RESPONSE carrying the same varbinds (RFC 3416 4.2.7)
+func (r *TrapReceiver) acknowledge(conn net.PacketConn, to net.Addr, n *Notification) error {
+	msg := Message{
+		Version:   n.Version,
+		Community: n.Community,
+		PDU: PDU{
+			Envelope:  asn1binary.Envelope{Class: asn1binary.ClassContextSpecific, Tag: RESPONSE},
+			RequestID: n.requestID,
+			VarBinds:  n.varBinds,
+		},
+	}
+	frame, err := asn1binary.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling SNMP message: %v", err)
+	}
+	_, err = conn.WriteTo(frame, to)
+	return err
+}
+
+// OIDName returns the name of oid from the MIBs followed by any remaining
+// index, or the numeric form if it is unknown
+func OIDName(db *mibdb.Database, oid asn1go.OID) string {
+	if db == nil {
+		return oid.String()
+	}
+	branch, tail := db.FindOID(oid)
+	if branch == nil || branch.Object() == nil || branch.Object().Name() == "" {
+		return oid.String()
+	}
+	name := branch.Object().Name()
+	if len(tail) > 0 {
+		name += "." + tail.String()
+	}
+	return name
+}
+
+// NewLogHandler logs each notification with names resolved through db,
+// which may be nil
+func NewLogHandler(logger *slog.Logger, db *mibdb.Database) NotificationHandler {
+	return NotificationHandlerFunc(func(ctx context.Context, n *Notification) error {
+		attrs := []any{
+			slog.String("source", n.Source.String()),
+			slog.String("trap", OIDName(db, n.TrapOID)),
+			slog.Int64("uptime", n.UpTime),
+		}
+		sb := strings.Builder{}
+		for i := range n.VarBinds {
+			vb := &n.VarBinds[i]
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			value, _, err := DecodeValue(db, &vb.Value)
+			if err != nil {
+				value = fmt.Sprintf("%x", vb.Value.Bytes)
+			}
+			fmt.Fprintf(&sb, "%s=%s", OIDName(db, vb.OID), value)
+		}
+		attrs = append(attrs, slog.String("varbinds", sb.String()))
+		if n.Inform {
+			logger.InfoContext(ctx, "SNMP inform", attrs...)
+		} else {
+			logger.InfoContext(ctx, "SNMP trap", attrs...)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+func startTrapReceiver(t *testing.T, received chan *Notification) string {
+	r, err := NewTrapReceiver(WithTrapCommunities("public"), WithNotificationHandler(NotificationHandlerFunc(func(ctx context.Context, n *Notification) error {
+		received <- n
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go r.Serve(ctx, conn)
+	return conn.LocalAddr().String()
+}
+
+func TestInformAcknowledged(t *testing.T) {
+	received := make(chan *Notification, 1)
+	address := startTrapReceiver(t, received)
+
+	p, err := NewProtocol(WithV2("public"), WithReceiveTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := p.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	trap := TrapV1PDU{Enterprise: asn1go.OID{1, 3, 6, 1, 4, 1, 99999}, GenericTrap: EnterpriseSpecific, SpecificTrap: 7, Timestamp: 1234}
+	trap.AgentAddress = asn1binary.Value{Envelope: asn1binary.Envelope{Class: asn1binary.ClassApplication, Tag: 0}, Bytes: []byte{10, 0, 0, 1}}
+	inform, err := trap.ToV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := conn.Request(context.Background(), INFORM, inform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.VarBinds) != len(inform.VarBinds) {
+		t.Errorf("acknowledgement has %d varbinds, want %d", len(response.VarBinds), len(inform.VarBinds))
+	}
+
+	n := <-received
+	if !n.Inform || n.UpTime != 1234 || n.TrapOID.String() != "1.3.6.1.4.1.99999.0.7" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func TestTrapV1Received(t *testing.T) {
+	received := make(chan *Notification, 1)
+	address := startTrapReceiver(t, received)
+
+	message := TrapV1Message{
+		Version:   v1,
+		Community: "public",
+		PDU: TrapV1PDU{
+			Envelope:    asn1binary.Envelope{Class: asn1binary.ClassContextSpecific, Tag: TRAP},
+			Enterprise:  asn1go.OID{1, 3, 6, 1, 4, 1, 99999},
+			GenericTrap: LinkDown,
+			Timestamp:   42,
+			VarBinds:    []VarBind{{OID: sysDescr, Value: nullValue()}},
+		},
+	}
+	message.PDU.AgentAddress = asn1binary.Value{Envelope: asn1binary.Envelope{Class: asn1binary.ClassApplication, Tag: 0}, Bytes: []byte{10, 0, 0, 1}}
+	frame, err := asn1binary.Marshal(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Write(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-received:
+		if n.Inform || n.UpTime != 42 || n.TrapOID.String() != "1.3.6.1.6.3.1.1.5.3" {
+			t.Errorf("unexpected notification %+v", n)
+		}
+		if len(n.VarBinds) != 3 || !n.VarBinds[0].OID.Equal(sysDescr) {
+			t.Errorf("unexpected varbinds %v", n.VarBinds)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("trap was not received")
+	}
+}
@@ -0,0 +1,364 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+type AuthProtocol int
+
+const (
+	NoAuth AuthProtocol = iota
+	MD5
+	SHA
+	SHA224
+	SHA256
+	SHA384
+	SHA512
+)
+
+func (a AuthProtocol) String() string {
+	switch a {
+	case NoAuth:
+		return "none"
+	case MD5:
+		return "MD5"
+	case SHA:
+		return "SHA"
+	case SHA224:
+		return "SHA-224"
+	case SHA256:
+		return "SHA-256"
+	case SHA384:
+		return "SHA-384"
+	case SHA512:
+		return "SHA-512"
+	}
+	return fmt.Sprintf("AuthProtocol(%d)", int(a))
+}
+
+// ParseAuthProtocol accepts the names used by String, case insensitively
+func ParseAuthProtocol(s string) (AuthProtocol, error) {
+	s = strings.ReplaceAll(strings.ToUpper(s), "-", "")
+	for a := NoAuth; a <= SHA512; a++ {
+		if s == strings.ReplaceAll(strings.ToUpper(a.String()), "-", "") {
+			return a, nil
+		}
+	}
+	if s == "SHA1" {
+		return SHA, nil
+	}
+	return NoAuth, fmt.Errorf("unknown authentication protocol %q", s)
+}
+
+func (a AuthProtocol) newHash() func() hash.Hash {
+	switch a {
+	case MD5:
+		return md5.New
+	case SHA:
+		return sha1.New
+	case SHA224:
+		return sha256.New224
+	case SHA256:
+		return sha256.New
+	case SHA384:
+		return sha512.New384
+	case SHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// macLength is the truncated HMAC length carried in msgAuthenticationParameters (RFC 3414, RFC 7860)
+func (a AuthProtocol) macLength() int {
+	switch a {
+	case MD5, SHA:
+		return 12
+	case SHA224:
+		return 16
+	case SHA256:
+		return 24
+	case SHA384:
+		return 32
+	case SHA512:
+		return 48
+	}
+	return 0
+}
+
+type PrivProtocol int
+
+const (
+	NoPriv PrivProtocol = iota
+	DES
+	AES
+	AES192
+	AES256
+)
+
+func (p PrivProtocol) String() string {
+	switch p {
+	case NoPriv:
+		return "none"
+	case DES:
+		return "DES"
+	case AES:
+		return "AES"
+	case AES192:
+		return "AES-192"
+	case AES256:
+		return "AES-256"
+	}
+	return fmt.Sprintf("PrivProtocol(%d)", int(p))
+}
+
+// ParsePrivProtocol accepts the names used by String, case insensitively
+func ParsePrivProtocol(s string) (PrivProtocol, error) {
+	s = strings.ReplaceAll(strings.ToUpper(s), "-", "")
+	for p := NoPriv; p <= AES256; p++ {
+		if s == strings.ReplaceAll(strings.ToUpper(p.String()), "-", "") {
+			return p, nil
+		}
+	}
+	if s == "AES128" {
+		return AES, nil
+	}
+	return NoPriv, fmt.Errorf("unknown privacy protocol %q", s)
+}
+
+func (p PrivProtocol) keyLength() int {
+	switch p {
+	case DES:
+		return 16 // 8 bytes of key followed by 8 bytes of pre-IV
+	case AES:
+		return 16
+	case AES192:
+		return 24
+	case AES256:
+		return 32
+	}
+	return 0
+}
+
+// USMUser holds the credentials of a User-based Security Model user.
+// The security level is implied by which protocols are set.
+type USMUser struct {
+	Name           string
+	AuthProtocol   AuthProtocol
+	AuthPassphrase string
+	PrivProtocol   PrivProtocol
+	PrivPassphrase string
+}
+
+func (u *USMUser) validate() error {
+	if u.Name == "" {
+		return fmt.Errorf("user name is required")
+	}
+	if u.AuthProtocol == NoAuth {
+		if u.PrivProtocol != NoPriv {
+			return fmt.Errorf("privacy requires authentication")
+		}
+		return nil
+	}
+	if u.AuthProtocol.newHash() == nil {
+		return fmt.Errorf("unsupported authentication protocol %s", u.AuthProtocol)
+	}
+	if len(u.AuthPassphrase) < 8 {
+		return fmt.Errorf("authentication passphrase must be at least 8 characters")
+	}
+	if u.PrivProtocol == NoPriv {
+		return nil
+	}
+	if u.PrivProtocol.keyLength() == 0 {
+		return fmt.Errorf("unsupported privacy protocol %s", u.PrivProtocol)
+	}
+	if len(u.PrivPassphrase) < 8 {
+		return fmt.Errorf("privacy passphrase must be at least 8 characters")
+	}
+	return nil
+}
+
+func (u *USMUser) flags() byte {
+	var flags byte
+	if u.AuthProtocol != NoAuth {
+		flags |= flagAuth
+	}
+	if u.PrivProtocol != NoPriv {
+		flags |= flagPriv
+	}
+	return flags
+}
+
+// PassphraseToKey implements the password to key algorithm of RFC 3414 A.2
+func PassphraseToKey(auth AuthProtocol, passphrase string) []byte {
+	h := auth.newHash()()
+	buffer := make([]byte, 64)
+	pass := []byte(passphrase)
+	index := 0
+	for count := 0; count < 1048576; count += 64 {
+		for i := range buffer {
+			buffer[i] = pass[index%len(pass)]
+			index++
+		}
+		h.Write(buffer)
+	}
+	return h.Sum(nil)
+}
+
+// LocalizeKey derives the key for a specific authoritative engine (RFC 3414 A.2.2)
+func LocalizeKey(auth AuthProtocol, key []byte, engineID []byte) []byte {
+	h := auth.newHash()()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+type localizedKeys struct {
+	auth []byte
+	priv []byte
+}
+
+// usmKeys caches localized keys per engine as the password to key step is slow
+type usmKeys struct {
+	user  USMUser
+	ku    localizedKeys
+	lock  sync.Mutex
+	cache map[string]*localizedKeys
+}
+
+func newUSMKeys(user USMUser) *usmKeys {
+	k := &usmKeys{user: user, cache: make(map[string]*localizedKeys)}
+	if user.AuthProtocol != NoAuth {
+		k.ku.auth = PassphraseToKey(user.AuthProtocol, user.AuthPassphrase)
+		if user.PrivProtocol != NoPriv {
+			k.ku.priv = PassphraseToKey(user.AuthProtocol, user.PrivPassphrase)
+		}
+	}
+	return k
+}
+
+func (k *usmKeys) forEngine(engineID []byte) *localizedKeys {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	keys, ok := k.cache[string(engineID)]
+	if ok {
+		return keys
+	}
+	keys = &localizedKeys{}
+	if k.ku.auth != nil {
+		keys.auth = LocalizeKey(k.user.AuthProtocol, k.ku.auth, engineID)
+	}
+	if k.ku.priv != nil {
+		keys.priv = LocalizeKey(k.user.AuthProtocol, k.ku.priv, engineID)
+		keys.priv = extendKey(k.user.AuthProtocol, keys.priv, k.user.PrivProtocol.keyLength())
+	}
+	k.cache[string(engineID)] = keys
+	return keys
+}
+
+// extendKey lengthens a localized key for ciphers that need more material
+// than the hash provides (draft-blumenthal-aes-usm-04 section 3.1.2.1)
+func extendKey(auth AuthProtocol, key []byte, length int) []byte {
+	for len(key) < length {
+		h := auth.newHash()()
+		h.Write(key)
+		key = append(key, h.Sum(nil)...)
+	}
+	return key[:length]
+}
+
+func (k *usmKeys) mac(keys *localizedKeys, message []byte) []byte {
+	mac := hmac.New(k.user.AuthProtocol.newHash(), keys.auth)
+	mac.Write(message)
+	return mac.Sum(nil)[:k.user.AuthProtocol.macLength()]
+}
+
+// encrypt returns the cipher text and the msgPrivacyParameters (salt)
+func (k *usmKeys) encrypt(keys *localizedKeys, boots, engineTime int, salt uint64, plain []byte) ([]byte, []byte, error) {
+	switch k.user.PrivProtocol {
+	case DES:
+		privParams := make([]byte, 8)
+		binary.BigEndian.PutUint32(privParams, uint32(boots))
+		binary.BigEndian.PutUint32(privParams[4:], uint32(salt))
+		block, err := des.NewCipher(keys.priv[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = keys.priv[8+i] ^ privParams[i]
+		}
+		padded := plain
+		if len(padded)%8 != 0 {
+			padded = make([]byte, len(plain)+8-len(plain)%8)
+			copy(padded, plain)
+		}
+		out := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+		return out, privParams, nil
+	case AES, AES192, AES256:
+		privParams := make([]byte, 8)
+		binary.BigEndian.PutUint64(privParams, salt)
+		block, err := aes.NewCipher(keys.priv)
+		if err != nil {
+			return nil, nil, err
+		}
+		out := make([]byte, len(plain))
+		cipher.NewCFBEncrypter(block, aesIV(boots, engineTime, privParams)).XORKeyStream(out, plain)
+		return out, privParams, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported privacy protocol %s", k.user.PrivProtocol)
+}
+
+func (k *usmKeys) decrypt(keys *localizedKeys, boots, engineTime int, privParams []byte, encrypted []byte) ([]byte, error) {
+	if len(privParams) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters length %d", len(privParams))
+	}
+	switch k.user.PrivProtocol {
+	case DES:
+		if len(encrypted)%8 != 0 {
+			return nil, fmt.Errorf("encrypted data is not a multiple of the block size")
+		}
+		block, err := des.NewCipher(keys.priv[:8])
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = keys.priv[8+i] ^ privParams[i]
+		}
+		out := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, encrypted)
+		return out, nil
+	case AES, AES192, AES256:
+		block, err := aes.NewCipher(keys.priv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(encrypted))
+		cipher.NewCFBDecrypter(block, aesIV(boots, engineTime, privParams)).XORKeyStream(out, encrypted)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported privacy protocol %s", k.user.PrivProtocol)
+}
+
+// aesIV builds the IV described in RFC 3826 section 3.1.2.1
+func aesIV(boots, engineTime int, privParams []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], privParams)
+	return iv
+}
@@ -0,0 +1,224 @@
+package snmp
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+type keyTest struct {
+	Auth      AuthProtocol
+	Key       string
+	Localized string
+}
+
+func TestKeyLocalization(t *testing.T) {
+	// RFC 3414 A.3.1 and A.3.2
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	keyTests := []keyTest{
+		{Auth: MD5, Key: "9faf3283884e92834ebc9847d8edd963", Localized: "526f5eed9fcce26f8964c2930787d82b"},
+		{Auth: SHA, Key: "9fb5cc0381497b3793528939ff788d5d79145211", Localized: "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	for _, test := range keyTests {
+		t.Run(test.Auth.String(), func(t *testing.T) {
+			key := PassphraseToKey(test.Auth, "maplesyrup")
+			if got := hex.EncodeToString(key); got != test.Key {
+				t.Errorf("key got %s, want %s", got, test.Key)
+			}
+			localized := LocalizeKey(test.Auth, key, engineID)
+			if got := hex.EncodeToString(localized); got != test.Localized {
+				t.Errorf("localized key got %s, want %s", got, test.Localized)
+			}
+		})
+	}
+}
+
+var sysDescr = asn1go.OID{1, 3, 6, 1, 2, 1, 1, 1, 0}
+
+func TestV3RoundTrip(t *testing.T) {
+	users := []USMUser{
+		{Name: "noauth"},
+		{Name: "auth", AuthProtocol: SHA256, AuthPassphrase: "maplesyrup"},
+		{Name: "des", AuthProtocol: MD5, AuthPassphrase: "maplesyrup", PrivProtocol: DES, PrivPassphrase: "maplesyrup"},
+		{Name: "aes", AuthProtocol: SHA, AuthPassphrase: "maplesyrup", PrivProtocol: AES, PrivPassphrase: "maplesyrup"},
+		{Name: "aes256", AuthProtocol: SHA512, AuthPassphrase: "maplesyrup", PrivProtocol: AES256, PrivPassphrase: "maplesyrup"},
+	}
+	engine := &engineState{id: []byte{0x80, 0, 0x1f, 0x88, 4, 't', 'e', 's', 't'}, boots: 3, time: 1000, syncedAt: time.Now()}
+	for _, user := range users {
+		t.Run(user.Name, func(t *testing.T) {
+			p, err := NewProtocol(WithV3(user))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pdu := &PDU{RequestID: 42, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}}
+			frame, err := p.(*protocol).encodeV3(GET, pdu, v3Options{engine: engine, msgID: 7, flags: flagReportable})
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := p.DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.Community != user.Name || message.PDU.RequestID != 42 || message.PDU.Tag != GET {
+				t.Errorf("unexpected message %+v", message)
+			}
+			if len(message.PDU.VarBinds) != 1 || message.PDU.VarBinds[0].OID.String() != sysDescr.String() {
+				t.Errorf("unexpected varbinds %v", message.PDU.VarBinds)
+			}
+			if user.AuthProtocol != NoAuth {
+				frame[len(frame)-1] ^= 0xFF
+				_, err = p.DecodeFrame(frame)
+				if err == nil {
+					t.Errorf("tampered message was accepted")
+				}
+			}
+		})
+	}
+}
+
+func nullValue() asn1binary.Value {
+	return asn1binary.Value{Envelope: asn1binary.Envelope{Tag: asn1binary.TagNull}}
+}
+
+// fakeV3Agent answers GET requests for sysDescr, sending reports until the
+// manager has discovered the engine and synchronised its clock. With spoof
+// set each answer is preceded by an unauthenticated notInTimeWindow report
+// carrying a bogus clock and an unauthenticated response.
+func fakeV3Agent(t *testing.T, user USMUser, spoof bool) string {
+	p, err := NewProtocol(WithV3(user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := p.(*protocol)
+	engine := &engineState{id: []byte{0x80, 0, 0x1f, 0x88, 4, 'f', 'a', 'k', 'e'}, boots: 5, time: 12345, syncedAt: time.Now()}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			msg, params, pdu, err := agent.decodeV3(buffer[:n])
+			if err != nil {
+				t.Log(err)
+				continue
+			}
+			options := v3Options{engine: engine, msgID: msg.GlobalData.MsgID}
+			_, boots, now := engine.get()
+			reply := &PDU{RequestID: pdu.RequestID}
+			pType := RESPONSE
+			switch {
+			case len(params.EngineID) == 0:
+				pType = REPORT
+				options.noSecurity = true
+				reply.VarBinds = []VarBind{{OID: usmStatsUnknownEngineIDs, Value: nullValue()}}
+			case params.UserName != "" && user.AuthProtocol != NoAuth && (params.EngineBoots != boots || params.EngineTime < now-150):
+				pType = REPORT
+				reply.VarBinds = []VarBind{{OID: usmStatsNotInTimeWindows, Value: nullValue()}}
+			default:
+				descr := asn1binary.Value{}
+				descr.PackFromGoWithParameters(&asn1go.String{Elem: "fake agent"}, &asn1binary.Parameters{Tag: asn1binary.PtrToTag(asn1binary.TagOctetString)})
+				reply.VarBinds = []VarBind{{OID: sysDescr, Value: descr}}
+				if spoof {
+					forgedEngine := &engineState{id: engine.id, boots: 99, time: 1, syncedAt: time.Now()}
+					forged := v3Options{engine: forgedEngine, msgID: options.msgID, noSecurity: true}
+					report := &PDU{RequestID: pdu.RequestID, VarBinds: []VarBind{{OID: usmStatsNotInTimeWindows, Value: nullValue()}}}
+					response := &PDU{RequestID: pdu.RequestID, VarBinds: []VarBind{{OID: sysDescr, Value: spoofedDescr()}}}
+					for _, m := range []struct {
+						pType asn1binary.Tag
+						pdu   *PDU
+					}{{REPORT, report}, {RESPONSE, response}} {
+						frame, err := agent.encodeV3(m.pType, m.pdu, forged)
+						if err == nil {
+							conn.WriteToUDP(frame, from)
+						}
+					}
+				}
+			}
+			frame, err := agent.encodeV3(pType, reply, options)
+			if err != nil {
+				t.Log(err)
+				continue
+			}
+			conn.WriteToUDP(frame, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestV3Discovery(t *testing.T) {
+	users := []USMUser{
+		{Name: "noauth"},
+		{Name: "aes", AuthProtocol: SHA, AuthPassphrase: "maplesyrup", PrivProtocol: AES, PrivPassphrase: "maplesyrup"},
+	}
+	for _, user := range users {
+		t.Run(user.Name, func(t *testing.T) {
+			address := fakeV3Agent(t, user, false)
+			p, err := NewProtocol(WithV3(user))
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := p.Dial(address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			err = conn.Send(GET, &PDU{RequestID: 1, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pdu, err := conn.Receive()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pdu.VarBinds) != 1 || string(pdu.VarBinds[0].Value.Bytes) != "fake agent" {
+				t.Errorf("unexpected response %v", pdu.VarBinds)
+			}
+		})
+	}
+}
+
+func spoofedDescr() asn1binary.Value {
+	descr := asn1binary.Value{}
+	descr.PackFromGoWithParameters(&asn1go.String{Elem: "spoofed"}, &asn1binary.Parameters{Tag: asn1binary.PtrToTag(asn1binary.TagOctetString)})
+	return descr
+}
+
+func TestV3RejectsUnauthenticated(t *testing.T) {
+	user := USMUser{Name: "aes", AuthProtocol: SHA, AuthPassphrase: "maplesyrup", PrivProtocol: AES, PrivPassphrase: "maplesyrup"}
+	address := fakeV3Agent(t, user, true)
+	p, err := NewProtocol(WithV3(user), WithReceiveTimeout(time.Second), WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := p.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		pdu, err := conn.Request(context.Background(), GET, &PDU{VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pdu.VarBinds) != 1 || string(pdu.VarBinds[0].Value.Bytes) != "fake agent" {
+			t.Errorf("unexpected response %v", pdu.VarBinds)
+		}
+	}
+	_, boots, _ := conn.(*connection).engine.get()
+	if boots != 5 {
+		t.Errorf("engine boots were changed to %d by an unauthenticated report", boots)
+	}
+}
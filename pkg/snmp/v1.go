@@ -0,0 +1,153 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const v1 = 0
+
+// WithV1 selects SNMPv1. Error statuses returned by v1 agents use the same
+// numbering as v2c for the values v1 defines (noSuchName, badValue, ...)
+// so they are reported through CheckPDU in the same way.
+func WithV1(community string) ProtocolOption {
+	return func(p *protocol) error {
+		p.community = community
+		p.version = v1
+		return nil
+	}
+}
+
+// generic-trap values from RFC 1157
+const (
+	ColdStart = iota
+	WarmStart
+	LinkDown
+	LinkUp
+	AuthenticationFailure
+	EgpNeighborLoss
+	EnterpriseSpecific
+)
+
+// TrapV1PDU is the distinct Trap-PDU of SNMPv1 (RFC 1157 section 4.1.6)
+type TrapV1PDU struct {
+	asn1binary.Envelope
+	Enterprise   asn1go.OID
+	AgentAddress asn1binary.Value `asn1:"Application,tag=0"`
+	GenericTrap  int
+	SpecificTrap int
+	Timestamp    int       `asn1:"Application,tag=3"`
+	VarBinds     []VarBind `asn1:"Sequence,Constructed"`
+}
+
+type TrapV1Message struct {
+	Version   int
+	Community string `asn1:"OctetString"`
+	PDU       TrapV1PDU
+}
+
+func (trap *TrapV1PDU) AgentIP() net.IP {
+	return net.IP(trap.AgentAddress.Bytes)
+}
+
+var (
+	sysUpTimeOID          = asn1go.OID{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	snmpTrapOID           = asn1go.OID{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+	snmpTrapEnterpriseOID = asn1go.OID{1, 3, 6, 1, 6, 3, 1, 1, 4, 3, 0}
+	snmpTrapAddressOID    = asn1go.OID{1, 3, 6, 1, 6, 3, 18, 1, 3, 0}
+	snmpTrapsOID          = asn1go.OID{1, 3, 6, 1, 6, 3, 1, 1, 5}
+)
+
+// TrapOID returns the notification OID that identifies the trap as described
+// in RFC 3584 section 3.1
+func (trap *TrapV1PDU) TrapOID() asn1go.OID {
+	var oid asn1go.OID
+	if trap.GenericTrap != EnterpriseSpecific {
+		oid = append(oid, snmpTrapsOID...)
+		return append(oid, trap.GenericTrap+1)
+	}
+	oid = append(oid, trap.Enterprise...)
+	return append(oid, 0, trap.SpecificTrap)
+}
+
+// ToV2 converts the trap into the varbind layout of a v2c notification
+// (RFC 3584 section 3.1) so handlers only need to deal with one form.
+func (trap *TrapV1PDU) ToV2() (*PDU, error) {
+	upTime := asn1go.Integer{}
+	upTime.SetInt(int64(trap.Timestamp))
+	trapOID := trap.TrapOID()
+	enterprise := trap.Enterprise
+
+	pdu := &PDU{
+		Envelope: asn1binary.Envelope{Class: asn1binary.ClassContextSpecific, Tag: TRAP_V2},
+	}
+	vb := VarBind{OID: sysUpTimeOID}
+	err := vb.Value.PackFromGoWithParameters(&upTime, &asn1binary.Parameters{Class: asn1binary.PtrToClass(asn1binary.ClassApplication), Tag: asn1binary.PtrToTag(3)})
+	if err != nil {
+		return nil, err
+	}
+	pdu.VarBinds = append(pdu.VarBinds, vb)
+
+	vb = VarBind{OID: snmpTrapOID}
+	err = vb.Value.PackFromGo(&trapOID)
+	if err != nil {
+		return nil, err
+	}
+	pdu.VarBinds = append(pdu.VarBinds, vb)
+	pdu.VarBinds = append(pdu.VarBinds, trap.VarBinds...)
+
+	pdu.VarBinds = append(pdu.VarBinds, VarBind{OID: snmpTrapAddressOID, Value: trap.AgentAddress})
+
+	vb = VarBind{OID: snmpTrapEnterpriseOID}
+	err = vb.Value.PackFromGo(&enterprise)
+	if err != nil {
+		return nil, err
+	}
+	pdu.VarBinds = append(pdu.VarBinds, vb)
+	return pdu, nil
+}
+
+// peekPDUTag returns the tag of the PDU in a v1 or v2c message
+func peekPDUTag(frame []byte) (asn1binary.Tag, error) {
+	var outer, element asn1binary.Value
+	_, err := outer.Unmarshal(frame)
+	if err != nil {
+		return 0, err
+	}
+	tail := outer.Bytes
+	for i := 0; i < 3; i++ {
+		tail, err = element.Unmarshal(tail)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return element.Tag, nil
+}
+
+// DecodeTrapV1 decodes a v1 message that carries a Trap-PDU
+func DecodeTrapV1(frame []byte) (*TrapV1Message, error) {
+	message := TrapV1Message{}
+	_, err := asn1binary.Unmarshal(frame, &message)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SNMPv1 trap: %v", err)
+	}
+	if message.Version != v1 {
+		return nil, fmt.Errorf("expected version %d but got %d", v1, message.Version)
+	}
+	return &message, nil
+}
+
+func (p *protocol) decodeTrapV1(frame []byte) (*Message, error) {
+	trap, err := DecodeTrapV1(frame)
+	if err != nil {
+		return nil, err
+	}
+	pdu, err := trap.PDU.ToV2()
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Version: trap.Version, Community: trap.Community, PDU: *pdu}, nil
+}
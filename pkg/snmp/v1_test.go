@@ -0,0 +1,127 @@
+package snmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+// testTrapV1 is a v1 linkDown trap from 10.0.0.1 for enterprise
+// 1.3.6.1.4.1.9 with a timestamp of 42 and no varbinds
+var testTrapV1 = []byte{
+	0x30, 0x26,
+	0x02, 0x01, 0x00,
+	0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+	0xA4, 0x19,
+	0x06, 0x06, 0x2B, 0x06, 0x01, 0x04, 0x01, 0x09,
+	0x40, 0x04, 0x0A, 0x00, 0x00, 0x01,
+	0x02, 0x01, 0x02,
+	0x02, 0x01, 0x00,
+	0x43, 0x01, 0x2A,
+	0x30, 0x00,
+}
+
+// TestTrapOID checks the RFC 3584 section 3.1 mapping of RFC 1157 traps
+func TestTrapOID(t *testing.T) {
+	enterprise := asn1go.OID{1, 3, 6, 1, 4, 1, 9}
+	trapOIDTests := []struct {
+		Generic  int
+		Specific int
+		OID      string
+	}{
+		{Generic: ColdStart, OID: "1.3.6.1.6.3.1.1.5.1"},
+		{Generic: WarmStart, OID: "1.3.6.1.6.3.1.1.5.2"},
+		{Generic: LinkDown, OID: "1.3.6.1.6.3.1.1.5.3"},
+		{Generic: LinkUp, OID: "1.3.6.1.6.3.1.1.5.4"},
+		{Generic: AuthenticationFailure, OID: "1.3.6.1.6.3.1.1.5.5"},
+		{Generic: EgpNeighborLoss, OID: "1.3.6.1.6.3.1.1.5.6"},
+		{Generic: EnterpriseSpecific, Specific: 1, OID: "1.3.6.1.4.1.9.0.1"},
+		{Generic: EnterpriseSpecific, Specific: 300, OID: "1.3.6.1.4.1.9.0.300"},
+	}
+	for _, test := range trapOIDTests {
+		trap := TrapV1PDU{Enterprise: enterprise, GenericTrap: test.Generic, SpecificTrap: test.Specific}
+		if got := trap.TrapOID().String(); got != test.OID {
+			t.Errorf("generic %d specific %d maps to %s, want %s", test.Generic, test.Specific, got, test.OID)
+		}
+	}
+}
+
+func TestDecodeTrapV1(t *testing.T) {
+	message, err := DecodeTrapV1(testTrapV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trap := &message.PDU
+	if message.Community != "public" || trap.Tag != TRAP || trap.GenericTrap != LinkDown || trap.Timestamp != 42 {
+		t.Errorf("unexpected trap %+v", message)
+	}
+	if !trap.Enterprise.Equal(asn1go.OID{1, 3, 6, 1, 4, 1, 9}) || trap.AgentIP().String() != "10.0.0.1" {
+		t.Errorf("trap from %s for %s", trap.AgentIP(), trap.Enterprise)
+	}
+
+	//the RFC 3584 varbinds, sysUpTime.0 and snmpTrapOID.0 first and
+	//snmpTrapAddress.0 and snmpTrapEnterprise.0 last
+	p, err := NewProtocol(WithV1("public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := p.DecodeFrame(testTrapV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdu := &decoded.PDU
+	if pdu.Tag != TRAP_V2 || len(pdu.VarBinds) != 4 {
+		t.Fatalf("converted to %s with %d varbinds", pdu.Envelope.String(), len(pdu.VarBinds))
+	}
+	wantOIDs := []asn1go.OID{sysUpTimeOID, snmpTrapOID, snmpTrapAddressOID, snmpTrapEnterpriseOID}
+	for i, want := range wantOIDs {
+		if !pdu.VarBinds[i].OID.Equal(want) {
+			t.Errorf("varbind %d is %s, want %s", i, pdu.VarBinds[i].OID, want)
+		}
+	}
+	upTime := pdu.VarBinds[0].Value
+	if upTime.Class != asn1binary.ClassApplication || upTime.Tag != 3 || !bytes.Equal(upTime.Bytes, []byte{42}) {
+		t.Errorf("sysUpTime.0 is %s 0x%X", upTime.Envelope.String(), upTime.Bytes)
+	}
+	var trapOID asn1go.OID
+	err = pdu.VarBinds[1].Value.UnpackIntoGo(&trapOID)
+	if err != nil || trapOID.String() != "1.3.6.1.6.3.1.1.5.3" {
+		t.Errorf("snmpTrapOID.0 is %s, %v", trapOID, err)
+	}
+	if !bytes.Equal(pdu.VarBinds[2].Value.Bytes, []byte{10, 0, 0, 1}) {
+		t.Errorf("snmpTrapAddress.0 is 0x%X", pdu.VarBinds[2].Value.Bytes)
+	}
+}
+
+func TestEncodeV1(t *testing.T) {
+	p, err := NewProtocol(WithV1("public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.EncodePDU(GET, &PDU{RequestID: 1, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x30, 0x26,
+		0x02, 0x01, 0x00,
+		0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xA0, 0x19,
+		0x02, 0x01, 0x01,
+		0x02, 0x01, 0x00,
+		0x02, 0x01, 0x00,
+		0x30, 0x0E,
+		0x30, 0x0C,
+		0x06, 0x08, 0x2B, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00,
+		0x05, 0x00,
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got 0x%X, want 0x%X", b, want)
+	}
+	_, err = p.EncodePDU(GET_BULK, &PDU{})
+	if err == nil {
+		t.Error("GET_BULK encoded for SNMPv1")
+	}
+}
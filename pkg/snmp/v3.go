@@ -0,0 +1,336 @@
+package snmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+const v3 = 3
+
+const usmSecurityModel = 3
+
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+// REPORT is the SNMPv2 Report-PDU tag, used by v3 agents to signal USM errors
+const REPORT = asn1binary.Tag(0x28)
+
+var (
+	usmStatsUnsupportedSecLevels = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 1, 0}
+	usmStatsNotInTimeWindows     = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 2, 0}
+	usmStatsUnknownUserNames     = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 3, 0}
+	usmStatsUnknownEngineIDs     = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 4, 0}
+	usmStatsWrongDigests         = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 5, 0}
+	usmStatsDecryptionErrors     = asn1go.OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 6, 0}
+)
+
+var reportNames = map[string]string{
+	usmStatsUnsupportedSecLevels.String(): "unsupported security level",
+	usmStatsNotInTimeWindows.String():     "not in time window",
+	usmStatsUnknownUserNames.String():     "unknown user name",
+	usmStatsUnknownEngineIDs.String():     "unknown engine id",
+	usmStatsWrongDigests.String():         "wrong digest",
+	usmStatsDecryptionErrors.String():     "decryption error",
+}
+
+// ReportError is returned when a v3 agent answers with a Report-PDU
+type ReportError struct {
+	OID asn1go.OID
+}
+
+func (e *ReportError) Error() string {
+	name, ok := reportNames[e.OID.String()]
+	if !ok {
+		name = e.OID.String()
+	}
+	return "snmp report: " + name
+}
+
+// recoverable reports are answered by resending once the engine state the
+// report carried has been adopted
+func (e *ReportError) recoverable() bool {
+	return e.OID.String() == usmStatsNotInTimeWindows.String() || e.OID.String() == usmStatsUnknownEngineIDs.String()
+}
+
+type v3HeaderData struct {
+	MsgID         int
+	MaxSize       int
+	Flags         asn1go.OctetString
+	SecurityModel int
+}
+
+type v3Message struct {
+	Version            int
+	GlobalData         v3HeaderData
+	SecurityParameters asn1go.OctetString
+	Data               asn1binary.Value
+}
+
+type usmSecurityParameters struct {
+	EngineID    asn1go.OctetString
+	EngineBoots int
+	EngineTime  int
+	UserName    string `asn1:"OctetString"`
+	AuthParams  asn1go.OctetString
+	PrivParams  asn1go.OctetString
+}
+
+type scopedPDU struct {
+	ContextEngineID asn1go.OctetString
+	ContextName     string `asn1:"OctetString"`
+	PDU             PDU
+}
+
+// engineState tracks the authoritative engine of an agent (RFC 3414 section 2.3)
+type engineState struct {
+	lock     sync.Mutex
+	id       []byte
+	boots    int
+	time     int
+	syncedAt time.Time
+}
+
+func (e *engineState) get() ([]byte, int, int) {
+	if e == nil {
+		return nil, 0, 0
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.id) == 0 {
+		return nil, 0, 0
+	}
+	return e.id, e.boots, e.time + int(time.Since(e.syncedAt)/time.Second)
+}
+
+func (e *engineState) update(params *usmSecurityParameters) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.id = params.EngineID
+	e.boots = params.EngineBoots
+	e.time = params.EngineTime
+	e.syncedAt = time.Now()
+}
+
+func (e *engineState) discovered() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.id) > 0
+}
+
+func (e *engineState) synchronised() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.boots != 0 || e.time != 0
+}
+
+func WithV3(user USMUser) ProtocolOption {
+	return func(p *protocol) error {
+		err := user.validate()
+		if err != nil {
+			return err
+		}
+		p.version = v3
+		p.usm = newUSMKeys(user)
+		var seed [8]byte
+		_, err = rand.Read(seed[:])
+		if err != nil {
+			return err
+		}
+		p.salt.Store(binary.BigEndian.Uint64(seed[:]))
+		return nil
+	}
+}
+
+// v3Options control the per message fields that are not part of the PDU
+type v3Options struct {
+	engine     *engineState
+	msgID      int
+	flags      byte
+	noSecurity bool // send as noAuthNoPriv with an empty user, for engine discovery
+}
+
+func (p *protocol) encodeV3(pType asn1binary.Tag, pdu *PDU, options v3Options) ([]byte, error) {
+	engineID, boots, engineTime := options.engine.get()
+
+	flags := options.flags
+	userName := ""
+	if !options.noSecurity {
+		flags |= p.usm.user.flags()
+		userName = p.usm.user.Name
+	}
+
+	scoped := scopedPDU{
+		ContextEngineID: engineID,
+		PDU:             *pdu,
+	}
+	scoped.PDU.Tag = pType
+	scoped.PDU.Class = asn1binary.ClassContextSpecific
+
+	params := usmSecurityParameters{
+		EngineID:    engineID,
+		EngineBoots: boots,
+		EngineTime:  engineTime,
+		UserName:    userName,
+	}
+
+	var keys *localizedKeys
+	if flags&flagAuth != 0 {
+		keys = p.usm.forEngine(engineID)
+		params.AuthParams = make([]byte, p.usm.user.AuthProtocol.macLength())
+	}
+
+	msg := v3Message{
+		Version: v3,
+		GlobalData: v3HeaderData{
+			MsgID:         options.msgID,
+			MaxSize:       p.bufferSize,
+			Flags:         asn1go.OctetString{flags},
+			SecurityModel: usmSecurityModel,
+		},
+	}
+
+	if flags&flagPriv != 0 {
+		plain, err := asn1binary.Marshal(&scoped)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling scoped PDU: %v", err)
+		}
+		encrypted, privParams, err := p.usm.encrypt(keys, boots, engineTime, p.salt.Add(1), plain)
+		if err != nil {
+			return nil, err
+		}
+		params.PrivParams = privParams
+		msg.Data = asn1binary.Value{Envelope: asn1binary.Envelope{Tag: asn1binary.TagOctetString}, Bytes: encrypted}
+	} else {
+		err := msg.Data.PackFromGo(&scoped)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling scoped PDU: %v", err)
+		}
+	}
+
+	var err error
+	msg.SecurityParameters, err = asn1binary.Marshal(&params)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling security parameters: %v", err)
+	}
+	frame, err := asn1binary.Marshal(&msg)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling SNMP message: %v", err)
+	}
+
+	if flags&flagAuth != 0 {
+		offset, err := authParamsOffset(frame, msg.SecurityParameters, params.AuthParams)
+		if err != nil {
+			return nil, err
+		}
+		copy(frame[offset:], p.usm.mac(keys, frame))
+	}
+	return frame, nil
+}
+
+// authParamsOffset finds msgAuthenticationParameters inside an encoded message
+func authParamsOffset(frame []byte, securityParameters []byte, authParams []byte) (int, error) {
+	start := bytes.Index(frame, securityParameters)
+	if start < 0 {
+		return 0, fmt.Errorf("security parameters not found in message")
+	}
+	encoded := append([]byte{byte(asn1binary.TagOctetString), byte(len(authParams))}, authParams...)
+	offset := bytes.LastIndex(securityParameters, encoded)
+	if offset < 0 {
+		return 0, fmt.Errorf("authentication parameters not found in message")
+	}
+	return start + offset + 2, nil
+}
+
+func (p *protocol) decodeV3(frame []byte) (*v3Message, *usmSecurityParameters, *PDU, error) {
+	msg := &v3Message{}
+	_, err := asn1binary.Unmarshal(frame, msg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error unmarshaling SNMP message: %v", err)
+	}
+	if msg.GlobalData.SecurityModel != usmSecurityModel {
+		return nil, nil, nil, fmt.Errorf("unsupported security model %d", msg.GlobalData.SecurityModel)
+	}
+	if len(msg.GlobalData.Flags) != 1 {
+		return nil, nil, nil, fmt.Errorf("invalid message flags")
+	}
+	flags := msg.GlobalData.Flags[0]
+
+	params := &usmSecurityParameters{}
+	_, err = asn1binary.Unmarshal(msg.SecurityParameters, params)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error unmarshaling security parameters: %v", err)
+	}
+
+	var keys *localizedKeys
+	if flags&flagAuth != 0 {
+		if p.usm == nil || p.usm.user.AuthProtocol == NoAuth {
+			return nil, nil, nil, fmt.Errorf("authenticated message but no authentication configured")
+		}
+		if params.UserName != p.usm.user.Name {
+			return nil, nil, nil, fmt.Errorf("message for unknown user %q", params.UserName)
+		}
+		keys = p.usm.forEngine(params.EngineID)
+		offset, err := authParamsOffset(frame, msg.SecurityParameters, params.AuthParams)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		zeroed := make([]byte, len(frame))
+		copy(zeroed, frame)
+		clear(zeroed[offset : offset+len(params.AuthParams)])
+		if !hmac.Equal(p.usm.mac(keys, zeroed), params.AuthParams) {
+			return nil, nil, nil, fmt.Errorf("authentication failure")
+		}
+	}
+
+	scoped := &scopedPDU{}
+	if flags&flagPriv != 0 {
+		if msg.Data.Tag != asn1binary.TagOctetString {
+			return nil, nil, nil, fmt.Errorf("expected encrypted scoped PDU")
+		}
+		if keys == nil || p.usm.user.PrivProtocol == NoPriv {
+			return nil, nil, nil, fmt.Errorf("encrypted message but no privacy configured")
+		}
+		plain, err := p.usm.decrypt(keys, params.EngineBoots, params.EngineTime, params.PrivParams, msg.Data.Bytes)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		_, err = asn1binary.Unmarshal(plain, scoped)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error unmarshaling decrypted scoped PDU: %v", err)
+		}
+	} else {
+		err = msg.Data.UnpackIntoGo(scoped)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error unmarshaling scoped PDU: %v", err)
+		}
+	}
+	return msg, params, &scoped.PDU, nil
+}
+
+// reportError converts a Report-PDU into a *ReportError
+func reportError(pdu *PDU) *ReportError {
+	if len(pdu.VarBinds) == 0 {
+		return &ReportError{}
+	}
+	return &ReportError{OID: pdu.VarBinds[0].OID}
+}
+
+// reportableFlag is set on requests so the agent may answer with a Report-PDU
+func reportableFlag(pType asn1binary.Tag) byte {
+	switch pType {
+	case RESPONSE, TRAP, TRAP_V2, REPORT:
+		return 0
+	}
+	return flagReportable
+}
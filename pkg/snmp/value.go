@@ -1,14 +1,28 @@
 package snmp
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"net"
+	"strconv"
 
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
 	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
 	"github.com/davidjspooner/net-mapper/pkg/snmp/mibdb"
 )
 
+// application tags of the SMI types (RFC 2578 section 7.1)
+const (
+	TagIpAddress   asn1binary.Tag = 0
+	TagCounter32   asn1binary.Tag = 1
+	TagGauge32     asn1binary.Tag = 2
+	TagTimeTicks   asn1binary.Tag = 3
+	TagOpaque      asn1binary.Tag = 4
+	TagNsapAddress asn1binary.Tag = 5
+	TagCounter64   asn1binary.Tag = 6
+)
+
 type ValueType int
 
 const (
@@ -22,8 +36,20 @@ const (
 	UnsignedValue
 	IPValue
 	OpaqueValue
+	Counter64Value
+	FloatValue
+	DoubleValue
+	NsapAddressValue
+	NoSuchObjectValue
+	NoSuchInstanceValue
+	EndOfMibViewValue
 )
 
+// IsException reports whether t is one of the SNMPv2 exceptions
+func (t ValueType) IsException() bool {
+	return t == NoSuchObjectValue || t == NoSuchInstanceValue || t == EndOfMibViewValue
+}
+
 func (t ValueType) String() string {
 	switch t {
 	case NullValue:
@@ -46,6 +72,20 @@ func (t ValueType) String() string {
 		return "IP"
 	case OpaqueValue:
 		return "Opaque"
+	case Counter64Value:
+		return "Counter64"
+	case FloatValue:
+		return "Float"
+	case DoubleValue:
+		return "Double"
+	case NsapAddressValue:
+		return "NsapAddress"
+	case NoSuchObjectValue:
+		return "noSuchObject"
+	case NoSuchInstanceValue:
+		return "noSuchInstance"
+	case EndOfMibViewValue:
+		return "endOfMibView"
 	}
 	return "Unknown"
 }
@@ -88,49 +128,253 @@ func init() {
 	valueFormatFuncMap[UnsignedValue] = valueFormatFuncMap[IntegerValue]
 }
 
+// DecodeValue renders v as text, resolving OIDs through db which may be nil
 func DecodeValue(db *mibdb.Database, v *asn1binary.Value) (string, ValueType, error) {
+	typed, valueType, err := DecodeTypedValue(v)
+	if err != nil {
+		return "", valueType, err
+	}
+	switch typed := typed.(type) {
+	case []byte:
+		switch valueType {
+		case StringValue:
+			return string(typed), valueType, nil
+		case NsapAddressValue:
+			return formatOctets(&MetricMeta{displayHint: "x"}, typed), valueType, nil
+		}
+		return fmt.Sprintf("%x", typed), valueType, nil
+	case int64:
+		return strconv.FormatInt(typed, 10), valueType, nil
+	case uint32:
+		return strconv.FormatUint(uint64(typed), 10), valueType, nil
+	case uint64:
+		return strconv.FormatUint(typed, 10), valueType, nil
+	case float32:
+		return strconv.FormatFloat(float64(typed), 'g', -1, 32), valueType, nil
+	case float64:
+		return strconv.FormatFloat(typed, 'g', -1, 64), valueType, nil
+	case asn1go.OID:
+		return OIDName(db, typed), valueType, nil
+	case net.IP:
+		return typed.String(), valueType, nil
+	}
+	if valueType.IsException() {
+		return valueType.String(), valueType, nil
+	}
+	return "", valueType, nil
+}
+
+// DecodeTypedValue decodes v into the Go type for its SMI type:
+//
+//	NullValue and the exceptions    nil
+//	StringValue, NsapAddressValue   []byte
+//	IntegerValue                    int64
+//	CounterValue, GaugeValue,
+//	TimeTicksValue, UnsignedValue   uint32 (uint64 when from an Opaque)
+//	Counter64Value                  uint64
+//	OidValue                        asn1go.OID
+//	IPValue                         net.IP
+//	FloatValue                      float32
+//	DoubleValue                     float64
+//	OpaqueValue                     []byte, when not a known extension
+func DecodeTypedValue(v *asn1binary.Value) (any, ValueType, error) {
 	switch v.Class {
 	case asn1binary.ClassUniversal:
 		switch v.Tag {
 		case asn1binary.TagNull:
-			return "", NullValue, nil
+			return nil, NullValue, nil
 		case asn1binary.TagOctetString:
-			var s asn1go.String
-			err := v.UnpackIntoGo(&s)
-			return s.String(), StringValue, err
+			return v.Bytes, StringValue, nil
 		case asn1binary.TagOID:
 			var oid asn1go.OID
 			err := v.UnpackIntoGo(&oid)
-			// Look up the OID in the MIB database
-			branch, tail := db.FindOID(oid)
-			s := branch.Object().Name()
-			if len(tail) > 0 {
-				s += "." + tail.String()
-			}
-			return s, OidValue, err
+			return oid, OidValue, err
 		case asn1binary.TagInteger:
-			var n asn1go.Integer
-			err := v.UnpackIntoGo(&n)
-			return n.String(), IntegerValue, err
+			n, err := decodeSigned(v.Bytes)
+			return n, IntegerValue, err
 		}
 	case asn1binary.ClassApplication:
 		switch v.Tag {
-		case 0:
-			var ip net.IP = v.Bytes
-			return ip.String(), IPValue, nil
-		case 1, 6:
-			var n asn1go.Integer
-			err := v.UnpackIntoGo(&n)
-			return n.String(), CounterValue, err
-		case 2:
-			var n asn1go.Integer
-			err := v.UnpackIntoGo(&n)
-			return n.String(), GaugeValue, err
-		case 3:
-			var n asn1go.Integer
-			err := v.UnpackIntoGo(&n)
-			return n.String(), TimeTicksValue, err
+		case TagIpAddress:
+			if len(v.Bytes) != 4 {
+				return nil, IPValue, fmt.Errorf("IpAddress has %d octets", len(v.Bytes))
+			}
+			return net.IP(v.Bytes), IPValue, nil
+		case TagCounter32, TagGauge32, TagTimeTicks:
+			valueType := map[asn1binary.Tag]ValueType{TagCounter32: CounterValue, TagGauge32: GaugeValue, TagTimeTicks: TimeTicksValue}[v.Tag]
+			n, err := decodeUnsigned(v.Bytes, 32)
+			return uint32(n), valueType, err
+		case TagCounter64:
+			n, err := decodeUnsigned(v.Bytes, 64)
+			return n, Counter64Value, err
+		case TagOpaque:
+			return decodeOpaque(v.Bytes)
+		case TagNsapAddress:
+			return v.Bytes, NsapAddressValue, nil
+		}
+	case asn1binary.ClassContextSpecific:
+		switch v.Tag {
+		case NO_SUCH_OBJECT:
+			return nil, NoSuchObjectValue, nil
+		case NO_SUCH_INSTANCE:
+			return nil, NoSuchInstanceValue, nil
+		case END_OF_MIB_VIEW:
+			return nil, EndOfMibViewValue, nil
+		}
+	}
+	return nil, NullValue, fmt.Errorf("unsupported value type %v", v)
+}
+
+func decodeSigned(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, fmt.Errorf("integer has %d octets", len(b))
+	}
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n, nil
+}
+
+// decodeUnsigned reads a non negative INTEGER of up to bits. Values with the
+// top bit set are accepted without the leading zero octet, as some agents
+// send them that way.
+func decodeUnsigned(b []byte, bits int) (uint64, error) {
+	if len(b) == 0 {
+		return 0, fmt.Errorf("unsigned integer is empty")
+	}
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) > bits/8 {
+		return 0, fmt.Errorf("unsigned integer has %d octets, more than %d bits", len(b), bits)
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// net-snmp carries types SNMPv2 lacks inside Opaque, BER encoded with an
+// extended context specific tag
+const (
+	opaqueTagPrefix  = 0x9f
+	opaqueCounter64  = 0x76
+	opaqueFloat      = 0x78
+	opaqueDouble     = 0x79
+	opaqueInteger64  = 0x7a
+	opaqueUnsigned64 = 0x7b
+)
+
+func decodeOpaque(b []byte) (any, ValueType, error) {
+	if len(b) < 3 || b[0] != opaqueTagPrefix || int(b[2]) != len(b)-3 {
+		return b, OpaqueValue, nil
+	}
+	data := b[3:]
+	switch b[1] {
+	case opaqueFloat:
+		if len(data) == 4 {
+			return math.Float32frombits(binary.BigEndian.Uint32(data)), FloatValue, nil
 		}
+	case opaqueDouble:
+		if len(data) == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(data)), DoubleValue, nil
+		}
+	case opaqueCounter64:
+		n, err := decodeUnsigned(data, 64)
+		return n, Counter64Value, err
+	case opaqueUnsigned64:
+		n, err := decodeUnsigned(data, 64)
+		return n, UnsignedValue, err
+	case opaqueInteger64:
+		n, err := decodeSigned(data)
+		return n, IntegerValue, err
 	}
-	return "", NullValue, fmt.Errorf("unsupported value type %v", v)
+	return b, OpaqueValue, nil
+}
+
+func newValue(class asn1binary.Class, tag asn1binary.Tag, b []byte) asn1binary.Value {
+	return asn1binary.Value{Envelope: asn1binary.Envelope{Class: class, Tag: tag}, Bytes: b}
+}
+
+// unsignedInteger encodes n as a non negative INTEGER, adding a leading zero
+// byte when the top bit is set
+func unsignedInteger(n uint64) []byte {
+	b := make([]byte, 9)
+	for i := 8; i > 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+	for len(b) > 1 && b[0] == 0 && b[1]&0x80 == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func NewNull() asn1binary.Value {
+	return newValue(asn1binary.ClassUniversal, asn1binary.TagNull, nil)
+}
+
+func NewInteger32(n int32) asn1binary.Value {
+	i := asn1go.Integer{}
+	i.SetInt(int64(n))
+	return newValue(asn1binary.ClassUniversal, asn1binary.TagInteger, i)
+}
+
+func NewOctetString(b []byte) asn1binary.Value {
+	return newValue(asn1binary.ClassUniversal, asn1binary.TagOctetString, b)
+}
+
+func NewOID(oid asn1go.OID) (asn1binary.Value, error) {
+	_, b, err := oid.PackAsn1(nil)
+	if err != nil {
+		return asn1binary.Value{}, err
+	}
+	return newValue(asn1binary.ClassUniversal, asn1binary.TagOID, b), nil
+}
+
+// NewIpAddress accepts only IPv4 addresses as IpAddress has no IPv6 form
+func NewIpAddress(ip net.IP) (asn1binary.Value, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return asn1binary.Value{}, fmt.Errorf("%s is not an IPv4 address", ip)
+	}
+	return newValue(asn1binary.ClassApplication, TagIpAddress, ip4), nil
+}
+
+func NewCounter32(n uint32) asn1binary.Value {
+	return newValue(asn1binary.ClassApplication, TagCounter32, unsignedInteger(uint64(n)))
+}
+
+func NewGauge32(n uint32) asn1binary.Value {
+	return newValue(asn1binary.ClassApplication, TagGauge32, unsignedInteger(uint64(n)))
+}
+
+// NewTimeTicks takes hundredths of a second
+func NewTimeTicks(n uint32) asn1binary.Value {
+	return newValue(asn1binary.ClassApplication, TagTimeTicks, unsignedInteger(uint64(n)))
+}
+
+// NewOpaque wraps b, which should itself be BER encoded
+func NewOpaque(b []byte) asn1binary.Value {
+	return newValue(asn1binary.ClassApplication, TagOpaque, b)
+}
+
+func NewCounter64(n uint64) asn1binary.Value {
+	return newValue(asn1binary.ClassApplication, TagCounter64, unsignedInteger(n))
+}
+
+// NewOpaqueFloat wraps f in an Opaque the way net-snmp does
+func NewOpaqueFloat(f float32) asn1binary.Value {
+	b := []byte{opaqueTagPrefix, opaqueFloat, 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[3:], math.Float32bits(f))
+	return NewOpaque(b)
+}
+
+// NewOpaqueDouble wraps f in an Opaque the way net-snmp does
+func NewOpaqueDouble(f float64) asn1binary.Value {
+	b := []byte{opaqueTagPrefix, opaqueDouble, 8, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[3:], math.Float64bits(f))
+	return NewOpaque(b)
 }
@@ -0,0 +1,123 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+func TestDecodeValue(t *testing.T) {
+	oid, _ := NewOID(asn1go.OID{1, 3, 6, 1})
+	ip, _ := NewIpAddress(net.IPv4(10, 0, 0, 1))
+	tests := []struct {
+		name      string
+		value     asn1binary.Value
+		typed     any
+		valueType ValueType
+		text      string
+	}{
+		{"null", NewNull(), nil, NullValue, ""},
+		{"integer", NewInteger32(-42), int64(-42), IntegerValue, "-42"},
+		{"string", NewOctetString([]byte("eth0")), []byte("eth0"), StringValue, "eth0"},
+		{"oid", oid, asn1go.OID{1, 3, 6, 1}, OidValue, "1.3.6.1"},
+		{"ip", ip, net.IP{10, 0, 0, 1}, IPValue, "10.0.0.1"},
+		{"counter32 max", NewCounter32(0xffffffff), uint32(0xffffffff), CounterValue, "4294967295"},
+		{"gauge32 without leading zero", newValue(asn1binary.ClassApplication, TagGauge32, []byte{0xff, 0xff, 0xff, 0xfe}), uint32(0xfffffffe), GaugeValue, "4294967294"},
+		{"timeticks", NewTimeTicks(12345), uint32(12345), TimeTicksValue, "12345"},
+		{"counter64 above 2^63", NewCounter64(1<<63 + 5), uint64(1<<63 + 5), Counter64Value, "9223372036854775813"},
+		{"counter64 max", NewCounter64(1<<64 - 1), uint64(1<<64 - 1), Counter64Value, "18446744073709551615"},
+		{"opaque float", NewOpaqueFloat(1.5), float32(1.5), FloatValue, "1.5"},
+		{"opaque double", NewOpaqueDouble(-0.25), float64(-0.25), DoubleValue, "-0.25"},
+		{"opaque counter64", NewOpaque([]byte{0x9f, 0x76, 2, 0x01, 0x00}), uint64(256), Counter64Value, "256"},
+		{"opaque int64", NewOpaque([]byte{0x9f, 0x7a, 1, 0xff}), int64(-1), IntegerValue, "-1"},
+		{"opaque raw", NewOpaque([]byte{0x04, 0x01, 0x41}), []byte{0x04, 0x01, 0x41}, OpaqueValue, "040141"},
+		{"nsap", newValue(asn1binary.ClassApplication, TagNsapAddress, []byte{0x47, 0x00, 0x05}), []byte{0x47, 0x00, 0x05}, NsapAddressValue, "47:00:05"},
+		{"noSuchObject", exception(NO_SUCH_OBJECT), nil, NoSuchObjectValue, "noSuchObject"},
+		{"noSuchInstance", exception(NO_SUCH_INSTANCE), nil, NoSuchInstanceValue, "noSuchInstance"},
+		{"endOfMibView", exception(END_OF_MIB_VIEW), nil, EndOfMibViewValue, "endOfMibView"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typed, valueType, err := DecodeTypedValue(&tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valueType != tt.valueType || !reflect.DeepEqual(typed, tt.typed) {
+				t.Errorf("got %v %#v, want %v %#v", valueType, typed, tt.valueType, tt.typed)
+			}
+			text, _, err := DecodeValue(nil, &tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text {
+				t.Errorf("got %q, want %q", text, tt.text)
+			}
+		})
+	}
+
+	invalid := []asn1binary.Value{
+		newValue(asn1binary.ClassApplication, TagCounter32, []byte{1, 0, 0, 0, 0}),
+		newValue(asn1binary.ClassApplication, TagIpAddress, []byte{10, 0, 0}),
+		newValue(asn1binary.ClassUniversal, asn1binary.TagInteger, nil),
+		newValue(asn1binary.ClassApplication, 9, nil),
+	}
+	for _, value := range invalid {
+		_, _, err := DecodeTypedValue(&value)
+		if err == nil {
+			t.Errorf("%v was accepted", value)
+		}
+	}
+}
+
+const opaqueTestMib = `OPAQUE-TEST-MIB DEFINITIONS ::= BEGIN
+
+test OBJECT IDENTIFIER ::= { iso 3 6 1 4 1 99999 }
+
+testLoad OBJECT-TYPE
+    SYNTAX Opaque
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "a float"
+    ::= { test 1 }
+
+testBlob OBJECT-TYPE
+    SYNTAX Opaque
+    ACCESS read-only
+    STATUS mandatory
+    DESCRIPTION "not a float"
+    ::= { test 2 }
+
+END
+`
+
+func TestPrintOpaque(t *testing.T) {
+	db := loadTestMib(t, "OPAQUE-TEST-MIB", opaqueTestMib)
+	buffer := &bytes.Buffer{}
+	printer := NewMetricPrinter(buffer, db)
+	varBinds := []VarBind{
+		{OID: asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 1, 0}, Value: NewOpaqueFloat(1.5)},
+		{OID: asn1go.OID{1, 3, 6, 1, 4, 1, 99999, 2, 0}, Value: NewOpaque([]byte{0x04, 0x01, 0x41})},
+	}
+	for i := range varBinds {
+		err := printer.Handle(context.Background(), &varBinds[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := printer.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "test_load 1.5") {
+		t.Errorf("the float is missing from %s", buffer.String())
+	}
+	if strings.Contains(buffer.String(), "test_blob") {
+		t.Errorf("the raw Opaque was exported in %s", buffer.String())
+	}
+}
@@ -0,0 +1,122 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+type walker struct {
+	maxRepetitions   int
+	allowNonIncrease bool
+}
+
+type WalkOption func(w *walker) error
+
+// WithMaxRepetitions sets how many rows a GET_BULK asks for per request.
+func WithMaxRepetitions(n int) WalkOption {
+	return func(w *walker) error {
+		if n < 1 {
+			return fmt.Errorf("max repetitions must be at least 1")
+		}
+		w.maxRepetitions = n
+		return nil
+	}
+}
+
+// WithNonIncreasingOIDs disables the check that each returned OID is greater
+// than the previous one. Some broken agents need this, at the risk of looping.
+func WithNonIncreasingOIDs() WalkOption {
+	return func(w *walker) error {
+		w.allowNonIncrease = true
+		return nil
+	}
+}
+
+// Walk retrieves every object below root and passes each varbind to handler.
+// It uses GET_BULK for v2c and above and falls back to GET_NEXT for v1.
+// The handler is not flushed; that is left to the caller so several subtrees
+// can be streamed into the same handler.
+func Walk(ctx context.Context, conn Connection, root asn1go.OID, handler VarBindHandler, options ...WalkOption) error {
+	w := &walker{
+		maxRepetitions: 10,
+	}
+	for _, option := range options {
+		err := option(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	last := root
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		varBinds, err := w.next(ctx, conn, last)
+		if err != nil {
+			return err
+		}
+		if len(varBinds) == 0 {
+			return nil
+		}
+		for i := range varBinds {
+			vb := &varBinds[i]
+			if vb.IsException() {
+				return nil
+			}
+			if !inSubtree(root, vb.OID) {
+				return nil
+			}
+			if !w.allowNonIncrease && !last.LessThan(vb.OID) {
+				return fmt.Errorf("%w: %s after %s", ErrNonIncreasingOID, vb.OID, last)
+			}
+			last = vb.OID
+			err = handler.Handle(ctx, vb)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *walker) next(ctx context.Context, conn Connection, oid asn1go.OID) ([]VarBind, error) {
+	pdu := &PDU{
+		VarBinds: []VarBind{
+			{OID: oid, Value: asn1binary.Value{Envelope: asn1binary.Envelope{Tag: asn1binary.TagNull}}},
+		},
+	}
+	pType := GET_NEXT
+	if conn.Version() >= v2c {
+		pType = GET_BULK
+		pdu.ErrorStatus = 0 //non-repeaters
+		pdu.ErrorIndex = w.maxRepetitions
+	}
+	response, err := conn.Request(ctx, pType, pdu)
+	if err != nil {
+		return nil, err
+	}
+	err = CheckPDU(response)
+	if err != nil {
+		if IsErrorStatus(err, NoSuchName) {
+			//v1 agents signal the end of the mib this way
+			return nil, nil
+		}
+		return nil, err
+	}
+	return response.VarBinds, nil
+}
+
+func inSubtree(root, oid asn1go.OID) bool {
+	if len(oid) < len(root) {
+		return false
+	}
+	for i := range root {
+		if root[i] != oid[i] {
+			return false
+		}
+	}
+	return true
+}
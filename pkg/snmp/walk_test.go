@@ -0,0 +1,113 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1binary"
+	"github.com/davidjspooner/net-mapper/pkg/asn1/asn1go"
+)
+
+// scriptedConnection answers each request with the next of its responses
+type scriptedConnection struct {
+	version   int
+	responses []*PDU
+	requests  []asn1binary.Tag
+}
+
+func (c *scriptedConnection) Version() int {
+	return c.version
+}
+
+func (c *scriptedConnection) Send(pType asn1binary.Tag, pdu *PDU) error {
+	return errors.ErrUnsupported
+}
+
+func (c *scriptedConnection) Receive() (*PDU, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (c *scriptedConnection) Request(ctx context.Context, pType asn1binary.Tag, pdu *PDU) (*PDU, error) {
+	c.requests = append(c.requests, pType)
+	if len(c.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	response := c.responses[0]
+	c.responses = c.responses[1:]
+	return response, nil
+}
+
+func (c *scriptedConnection) Close() error {
+	return nil
+}
+
+func responseOf(oids ...asn1go.OID) *PDU {
+	response := &PDU{}
+	for _, oid := range oids {
+		response.VarBinds = append(response.VarBinds, VarBind{OID: oid, Value: nullValue()})
+	}
+	return response
+}
+
+func TestWalkNonIncreasingOID(t *testing.T) {
+	root := asn1go.OID{1, 3, 6, 1, 2, 1, 1}
+	sysObjectID := asn1go.OID{1, 3, 6, 1, 2, 1, 1, 2, 0}
+	script := func() *scriptedConnection {
+		return &scriptedConnection{version: v2c, responses: []*PDU{
+			responseOf(sysObjectID, sysDescr),
+			{VarBinds: []VarBind{{OID: sysDescr, Value: exception(END_OF_MIB_VIEW)}}},
+		}}
+	}
+
+	c := &collector{}
+	err := Walk(context.Background(), script(), root, c)
+	if !errors.Is(err, ErrNonIncreasingOID) {
+		t.Errorf("got error %v, want %v", err, ErrNonIncreasingOID)
+	}
+	if len(c.varBinds) != 1 {
+		t.Errorf("handled %d varbinds before the error, want 1", len(c.varBinds))
+	}
+
+	c = &collector{}
+	conn := script()
+	err = Walk(context.Background(), conn, root, c, WithNonIncreasingOIDs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.varBinds) != 2 || !c.varBinds[1].OID.Equal(sysDescr) {
+		t.Errorf("handled %v, want sysObjectID then sysDescr", c.varBinds)
+	}
+	if len(conn.requests) != 2 || conn.requests[0] != GET_BULK {
+		t.Errorf("sent %v, want two GET_BULK requests", conn.requests)
+	}
+}
+
+// TestWalkV1NoSuchName ends a v1 walk on the noSuchName error RFC 1157
+// agents return when GET_NEXT runs off the end of their MIB
+func TestWalkV1NoSuchName(t *testing.T) {
+	conn := &scriptedConnection{version: v1, responses: []*PDU{
+		responseOf(sysDescr),
+		{ErrorStatus: int(NoSuchName), ErrorIndex: 1, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}},
+	}}
+	c := &collector{}
+	err := Walk(context.Background(), conn, asn1go.OID{1, 3, 6, 1}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.varBinds) != 1 || !c.varBinds[0].OID.Equal(sysDescr) {
+		t.Errorf("handled %v, want sysDescr", c.varBinds)
+	}
+	if len(conn.requests) != 2 || conn.requests[0] != GET_NEXT || conn.requests[1] != GET_NEXT {
+		t.Errorf("sent %v, want two GET_NEXT requests", conn.requests)
+	}
+
+	//any other error status still fails the walk
+	conn = &scriptedConnection{version: v1, responses: []*PDU{
+		{ErrorStatus: int(GenErr), ErrorIndex: 1, VarBinds: []VarBind{{OID: sysDescr, Value: nullValue()}}},
+	}}
+	err = Walk(context.Background(), conn, asn1go.OID{1, 3, 6, 1}, &collector{})
+	if !IsErrorStatus(err, GenErr) {
+		t.Errorf("got error %v, want genErr", err)
+	}
+}